@@ -0,0 +1,124 @@
+package goweb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// maxLoggedBodyBytes caps how much of a request body is kept for logging.
+const maxLoggedBodyBytes = 4 << 10
+
+var (
+	// the value is any JSON scalar; a string cut off by truncation runs to
+	// the end of the text so its prefix is masked too
+	secretJSONField = regexp.MustCompile(`(?i)("[\w-]*(?:password|passwd|secret|token|api_?key|authorization|card_?number|cvv|ssn)[\w-]*"\s*:\s*)(?:"(?:[^"\\]|\\.)*(?:"|\\?$)|-?[0-9][0-9.eE+-]*|true|false|null)`)
+	secretFormField = regexp.MustCompile(`(?i)((?:^|&)[\w-]*(?:password|passwd|secret|token|api_?key|authorization|card_?number|cvv|ssn)[\w-]*=)[^&]*`)
+)
+
+// bodyTee wraps a request body and keeps a capped copy of everything the
+// handler reads from it. mu guards the copy, which drain may still be adding
+// to after it returns.
+type bodyTee struct {
+	io.ReadCloser
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func newBodyTee(body io.ReadCloser, limit int) *bodyTee {
+	return &bodyTee{ReadCloser: body, limit: limit}
+}
+
+func (t *bodyTee) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		b := p[:n]
+		if room := t.limit - t.buf.Len(); room < len(b) {
+			t.truncated = true
+			b = b[:max(room, 0)]
+		}
+		t.buf.Write(b)
+	}
+	return n, err
+}
+
+// drainTimeout bounds how long drain waits for the rest of a body.
+const drainTimeout = 500 * time.Millisecond
+
+// drain reads the rest of the body, up to the capture limit, so a snapshot
+// taken after the handler gave up shows the whole (capped) body. A slow
+// client must not hold up the caller, so drain gives up when ctx is done or
+// after drainTimeout, leaving the read to finish in the background.
+func (t *bodyTee) drain(ctx context.Context) {
+	t.mu.Lock()
+	room := t.limit - t.buf.Len()
+	t.mu.Unlock()
+	if room <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(io.Discard, io.LimitReader(t, int64(room)+1))
+	}()
+
+	timer := time.NewTimer(drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// snapshot returns the captured body with obvious secrets redacted.
+func (t *bodyTee) snapshot() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := redactSecrets(t.buf.String())
+	if t.truncated {
+		s += "...(truncated)"
+	}
+	return s
+}
+
+// redactSecrets masks the values of JSON and form fields whose names look
+// like credentials.
+func redactSecrets(s string) string {
+	s = secretJSONField.ReplaceAllString(s, `$1"[REDACTED]"`)
+	return secretFormField.ReplaceAllString(s, `$1[REDACTED]`)
+}
+
+// BodyLogHandler logs the body of each request after the handler has run,
+// leaving it readable by the handler. Only what the handler reads is logged,
+// secrets are redacted and large bodies are truncated. It is meant for
+// debugging integrations and is added to the chain when Config.DevMode is on.
+func BodyLogHandler(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		tee := newBodyTee(r.Body, maxLoggedBodyBytes)
+		r.Body = tee
+
+		h.ServeHTTP(w, r) // serve the original request
+
+		if s := tee.snapshot(); s != "" {
+			log.Printf("Request body: %s %s %s", r.Method, r.RequestURI, s)
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
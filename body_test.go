@@ -0,0 +1,75 @@
+package goweb
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"password":"hunter2","name":"bob"}`, `{"password":"[REDACTED]","name":"bob"}`},
+		{`{"card_number":4111111111111111,"cvv": 123}`, `{"card_number":"[REDACTED]","cvv": "[REDACTED]"}`},
+		{`{"api_key":null,"token":true,"amount":12}`, `{"api_key":"[REDACTED]","token":"[REDACTED]","amount":12}`},
+		{`{"secret":"with \"escaped\" quotes"}`, `{"secret":"[REDACTED]"}`},
+		{`{"name":"bob","password":"hunt`, `{"name":"bob","password":"[REDACTED]"`},
+		{`{"name":"bob","password":"hunt\`, `{"name":"bob","password":"[REDACTED]"`},
+		{`user=bob&password=hunter2&cvv=123`, `user=bob&password=[REDACTED]&cvv=[REDACTED]`},
+	}
+	for _, tt := range tests {
+		if got := redactSecrets(tt.in); got != tt.want {
+			t.Errorf("redactSecrets(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBodyTeeTruncatedSecret(t *testing.T) {
+	body := `{"name":"bob","card_number":"4111111111111111"}`
+	limit := strings.Index(body, "4111") + 6
+
+	tee := newBodyTee(io.NopCloser(strings.NewReader(body)), limit)
+	tee.drain(context.Background())
+
+	got := tee.snapshot()
+	if strings.Contains(got, "4111") {
+		t.Errorf("snapshot leaks a truncated secret: %s", got)
+	}
+	if !strings.HasSuffix(got, "...(truncated)") {
+		t.Errorf("snapshot not marked truncated: %s", got)
+	}
+}
+
+func TestBodyTeeDrainSlowClient(t *testing.T) {
+	// a client that sent part of its body and then stalled
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go io.WriteString(pw, `{"cvv":123,`)
+
+	tee := newBodyTee(pr, maxLoggedBodyBytes)
+	start := time.Now()
+	tee.drain(context.Background())
+	if elapsed := time.Since(start); elapsed > 2*drainTimeout {
+		t.Fatalf("drain waited %s for a stalled client", elapsed)
+	}
+	if got := tee.snapshot(); got != `{"cvv":"[REDACTED]",` {
+		t.Errorf("snapshot = %s", got)
+	}
+}
+
+func TestBodyTeeDrainCancelled(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	newBodyTee(pr, maxLoggedBodyBytes).drain(ctx)
+	if elapsed := time.Since(start); elapsed >= drainTimeout {
+		t.Errorf("drain ignored the cancelled context for %s", elapsed)
+	}
+}
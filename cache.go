@@ -0,0 +1,268 @@
+package goweb
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStore stores cached responses. Implementations backed by a shared
+// store such as Redis or memcached let several instances share the cache.
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// MemoryCacheStore is the in-process CacheStore used by default. It holds at
+// most a fixed number of entries, evicting the least recently used first;
+// expired entries are dropped when they are next looked up or evicted.
+type MemoryCacheStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// defaultMaxCacheEntries is the capacity of a MemoryCacheStore created with a
+// non-positive maxEntries.
+const defaultMaxCacheEntries = 10000
+
+// NewMemoryCacheStore returns a store holding up to maxEntries responses,
+// or 10000 when maxEntries is not positive.
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxCacheEntries
+	}
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*memoryCacheEntry)
+	if time.Now().After(e.expires) {
+		s.remove(el)
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	return e.value, true
+}
+
+func (s *MemoryCacheStore) Set(key string, value []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &memoryCacheEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if el, ok := s.entries[key]; ok {
+		el.Value = e
+		s.lru.MoveToFront(el)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(e)
+	for s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+}
+
+func (s *MemoryCacheStore) remove(el *list.Element) {
+	s.lru.Remove(el)
+	delete(s.entries, el.Value.(*memoryCacheEntry).key)
+}
+
+// maxCachedResponseSize is the largest response body the cache stores.
+const maxCachedResponseSize = 1 << 20
+
+// ResponseCacheConfig controls NewResponseCacheHandler.
+type ResponseCacheConfig struct {
+	// Store holds the cached responses. Defaults to a MemoryCacheStore.
+	Store CacheStore
+
+	// TTL is how long responses are cached. Defaults to one minute.
+	TTL time.Duration
+
+	// VaryHeaders are request headers whose values are part of the cache
+	// key, e.g. Accept-Language. Accept-Encoding always is. Responses whose
+	// Vary header names any other request header are not cached, since the
+	// key could not tell their variants apart.
+	VaryHeaders []string
+
+	// Salt is mixed into every key. Changing it, e.g. per deploy, discards
+	// everything cached before.
+	Salt string
+}
+
+// cachedResponse is the stored form of a response.
+type cachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// NewResponseCacheHandler returns middleware caching successful responses to
+// safe methods such as GET and HEAD in c.Store, keyed by method, host and
+// URL. Requests carrying credentials or cookies and responses that set
+// cookies, are not 200, are marked no-store or private, or vary on headers
+// outside the key are never cached.
+// Placed in front of GZipHandler, as Config.ResponseCache is, it stores the
+// compressed output so hits are not compressed again.
+func NewResponseCacheHandler(c ResponseCacheConfig) func(http.Handler) http.Handler {
+	if c.Store == nil {
+		c.Store = NewMemoryCacheStore(0)
+	}
+	if c.TTL <= 0 {
+		c.TTL = time.Minute
+	}
+
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			if !IsSafeMethod(r) || !cacheableRequest(r) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			key := c.key(r)
+			if data, ok := c.Store.Get(key); ok {
+				var cached cachedResponse
+				if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&cached); err == nil {
+					for k, v := range cached.Header {
+						w.Header()[k] = v
+					}
+					w.Header().Set("X-Cache", "HIT")
+					w.WriteHeader(cached.Status)
+					w.Write(cached.Body)
+					return
+				}
+				c.Store.Delete(key)
+			}
+
+			rec := &cacheRecorder{statusRecorder: newStatusRecorder(w)}
+			h.ServeHTTP(rec, r)
+
+			if !rec.cacheable() || !c.coversVary(w.Header()) {
+				return
+			}
+			var buf bytes.Buffer
+			cached := cachedResponse{Status: rec.statusCode(), Header: w.Header().Clone(), Body: rec.body.Bytes()}
+			if err := gob.NewEncoder(&buf).Encode(cached); err == nil {
+				c.Store.Set(key, buf.Bytes(), c.TTL)
+			}
+		}
+		return http.HandlerFunc(f)
+	}
+}
+
+// cacheableRequest reports whether r may be answered from, and stored in, a
+// shared cache. Responses to requests with credentials or cookies may be
+// personalized even when they do not say so.
+func cacheableRequest(r *http.Request) bool {
+	return r.Header.Get("Authorization") == "" && r.Header.Get("Cookie") == ""
+}
+
+// coversVary reports whether every request header named in the response's
+// Vary header is part of the cache key.
+func (c ResponseCacheConfig) coversVary(h http.Header) bool {
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || strings.EqualFold(name, "Accept-Encoding") {
+				continue
+			}
+			if name == "*" || !containsFold(c.VaryHeaders, name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// key derives the cache key for r from the salt, method, host, path, query
+// and the request headers responses may vary on.
+func (c ResponseCacheConfig) key(r *http.Request) string {
+	hash := sha256.New()
+	write := func(s string) {
+		hash.Write([]byte(s))
+		hash.Write([]byte{0})
+	}
+
+	write(c.Salt)
+	write(r.Method)
+	write(strings.ToLower(r.Host))
+	write(r.URL.Path)
+	write(r.URL.RawQuery)
+	write(strings.Join(r.Header.Values("Accept-Encoding"), ","))
+	for _, name := range c.VaryHeaders {
+		write(name)
+		write(strings.Join(r.Header.Values(name), ","))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// cacheRecorder keeps a copy of the response body while passing it on.
+type cacheRecorder struct {
+	*statusRecorder
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+func (w *cacheRecorder) Write(b []byte) (int, error) {
+	if !w.tooLarge {
+		if w.body.Len()+len(b) > maxCachedResponseSize {
+			w.tooLarge = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.statusRecorder.Write(b)
+}
+
+func (w *cacheRecorder) cacheable() bool {
+	if w.tooLarge || w.statusCode() != http.StatusOK {
+		return false
+	}
+	h := w.Header()
+	if h.Get("Set-Cookie") != "" {
+		return false
+	}
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
@@ -0,0 +1,160 @@
+package goweb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingHandler answers every request with the number of requests it has
+// served and, for requests with a session cookie, the session.
+func countingHandler(n *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*n++
+		session := ""
+		if c, err := r.Cookie("session"); err == nil {
+			session = c.Value
+		}
+		fmt.Fprintf(w, "%d %s %s", *n, r.Host, session)
+	})
+}
+
+func TestResponseCacheHit(t *testing.T) {
+	var n int
+	h := NewResponseCacheHandler(ResponseCacheConfig{})(countingHandler(&n))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://a.example.com/page", nil))
+		if got := w.Body.String(); got != "1 a.example.com " {
+			t.Fatalf("request %d: body = %q", i, got)
+		}
+	}
+	if n != 1 {
+		t.Errorf("handler ran %d times, want 1", n)
+	}
+}
+
+func TestResponseCacheCrossUserAndHost(t *testing.T) {
+	var n int
+	h := NewResponseCacheHandler(ResponseCacheConfig{})(countingHandler(&n))
+
+	user := httptest.NewRequest(http.MethodGet, "http://a.example.com/page", nil)
+	user.AddCookie(&http.Cookie{Name: "session", Value: "alice"})
+	h.ServeHTTP(httptest.NewRecorder(), user)
+
+	// an anonymous request must not see the page rendered for alice
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://a.example.com/page", nil))
+	if w.Header().Get("X-Cache") == "HIT" || w.Body.String() != "2 a.example.com " {
+		t.Fatalf("anonymous request got %q (X-Cache %q)", w.Body.String(), w.Header().Get("X-Cache"))
+	}
+
+	// nor may another host see that anonymous page
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://b.example.com/page", nil))
+	if w.Header().Get("X-Cache") == "HIT" || w.Body.String() != "3 b.example.com " {
+		t.Fatalf("other host got %q (X-Cache %q)", w.Body.String(), w.Header().Get("X-Cache"))
+	}
+}
+
+func TestResponseCacheSkips(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		cfg    ResponseCacheConfig
+	}{
+		{"set cookie", http.Header{"Set-Cookie": {"session=x"}}, ResponseCacheConfig{}},
+		{"private", http.Header{"Cache-Control": {"private"}}, ResponseCacheConfig{}},
+		{"vary accept", http.Header{"Vary": {"Accept"}}, ResponseCacheConfig{}},
+		{"vary star", http.Header{"Vary": {"*"}}, ResponseCacheConfig{VaryHeaders: []string{"Accept"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n int
+			h := NewResponseCacheHandler(tt.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n++
+				for k, v := range tt.header {
+					w.Header()[k] = v
+				}
+				w.Write([]byte("ok"))
+			}))
+			for i := 0; i < 2; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			}
+			if n != 2 {
+				t.Errorf("handler ran %d times, want 2", n)
+			}
+		})
+	}
+}
+
+func TestResponseCacheMethods(t *testing.T) {
+	var n int
+	h := NewResponseCacheHandler(ResponseCacheConfig{})(countingHandler(&n))
+	serve := func(method string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "http://a.example.com/page", nil))
+		return w.Body.String()
+	}
+
+	// unsafe methods always reach the handler
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		serve(method)
+	}
+	if n != 4 {
+		t.Fatalf("handler ran %d times for unsafe requests, want 4", n)
+	}
+
+	// safe methods are cached, each under its own key
+	if got := serve(http.MethodGet); got != "5 a.example.com " {
+		t.Fatalf("GET = %q", got)
+	}
+	if got := serve(http.MethodOptions); got != "6 a.example.com " {
+		t.Fatalf("OPTIONS was answered from the GET entry: %q", got)
+	}
+	if got := serve(http.MethodOptions); got != "6 a.example.com " {
+		t.Errorf("second OPTIONS = %q, want the cached one", got)
+	}
+}
+
+func TestResponseCacheVaryHeaders(t *testing.T) {
+	h := NewResponseCacheHandler(ResponseCacheConfig{VaryHeaders: []string{"Accept"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept")
+		w.Write([]byte(r.Header.Get("Accept")))
+	}))
+
+	for _, accept := range []string{"image/webp", "image/png", "image/webp"} {
+		r := httptest.NewRequest(http.MethodGet, "/logo", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Body.String() != accept {
+			t.Errorf("Accept %s: body = %q", accept, w.Body.String())
+		}
+	}
+}
+
+func TestMemoryCacheStoreEvicts(t *testing.T) {
+	s := NewMemoryCacheStore(2)
+	s.Set("a", []byte("1"), time.Minute)
+	s.Set("b", []byte("2"), time.Minute)
+	s.Get("a")
+	s.Set("c", []byte("3"), time.Minute)
+
+	if _, ok := s.Get("b"); ok {
+		t.Error("least recently used entry was kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := s.Get(key); !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+
+	s.Set("d", []byte("4"), -time.Second)
+	if _, ok := s.Get("d"); ok {
+		t.Error("expired entry was returned")
+	}
+}
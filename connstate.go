@@ -0,0 +1,50 @@
+package goweb
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ConnectionStats is a snapshot of the server's client connections.
+type ConnectionStats struct {
+	// Active connections are serving a request.
+	Active int64
+	// Idle connections are kept alive waiting for the next request.
+	Idle int64
+	// New connections have been accepted but sent no request yet.
+	New int64
+}
+
+var (
+	connStates  sync.Map // net.Conn -> http.ConnState
+	connCounts  [3]atomic.Int64
+	trackStates = map[http.ConnState]int{http.StateNew: 0, http.StateActive: 1, http.StateIdle: 2}
+)
+
+// ConnStats returns the current number of new, active and idle connections,
+// for exporting as gauges.
+func ConnStats() ConnectionStats {
+	return ConnectionStats{
+		New:    connCounts[0].Load(),
+		Active: connCounts[1].Load(),
+		Idle:   connCounts[2].Load(),
+	}
+}
+
+// trackConnState is the http.Server ConnState hook maintaining ConnStats.
+func trackConnState(c net.Conn, state http.ConnState) {
+	if prev, ok := connStates.Load(c); ok {
+		connCounts[trackStates[prev.(http.ConnState)]].Add(-1)
+	}
+
+	i, tracked := trackStates[state]
+	if !tracked {
+		// closed or hijacked, the server no longer manages the connection
+		connStates.Delete(c)
+		return
+	}
+	connStates.Store(c, state)
+	connCounts[i].Add(1)
+}
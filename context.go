@@ -0,0 +1,213 @@
+package goweb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// contextKey is the type of every value goweb stores in a request context.
+// Being unexported, it cannot collide with keys from other packages; use the
+// accessor functions to read the values.
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	paramsKey
+	routePatternKey
+	valuesKey
+	localeKey
+	settingsKey
+)
+
+// RequestID returns the ID assigned to the request by RequestIDHandler, or
+// "" when there is none.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// Param returns the value of the :name or *name segment of the matched
+// route pattern, or "" when the route has no such param.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey).(map[string]string)
+	return params[name]
+}
+
+// RoutePattern returns the pattern of the route that matched the request,
+// e.g. "/users/:id", or "" before routing.
+func RoutePattern(r *http.Request) string {
+	pattern, _ := r.Context().Value(routePatternKey).(string)
+	return pattern
+}
+
+// withRoute returns r with the matched route pattern and params in its context.
+func withRoute(r *http.Request, pattern string, params map[string]string) *http.Request {
+	ctx := context.WithValue(r.Context(), routePatternKey, pattern)
+	ctx = context.WithValue(ctx, paramsKey, params)
+	return r.WithContext(ctx)
+}
+
+// RequestIDHandler gives each request an ID, readable with RequestID and
+// echoed in the X-Request-ID response header. A well-formed X-Request-ID
+// sent by an upstream proxy is kept so requests can be traced across hops.
+func RequestIDHandler(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	}
+	return http.HandlerFunc(fn)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// values is the per-request value bag read with Get and written with Set.
+// Handlers and middleware further down the chain share the one bag, so a
+// value set by any of them is visible to everything that runs after it.
+type values struct {
+	mu sync.RWMutex
+	m  map[string]interface{}
+}
+
+// ValuesHandler installs an empty value bag in each request so Set, Get and
+// ContextValueHandler can be used. The chain built by Start includes it first.
+func ValuesHandler(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(valuesKey).(*values); ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		bag := &values{m: make(map[string]interface{})}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), valuesKey, bag)))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// Set stores value under key in the request's value bag. Render passes the
+// bag to templates as .ctx, so middleware can hand values such as the current
+// user to views. Set does nothing when the request has no bag, i.e. it did
+// not pass through ValuesHandler.
+func Set(r *http.Request, key string, value interface{}) {
+	bag, ok := r.Context().Value(valuesKey).(*values)
+	if !ok {
+		return
+	}
+	bag.mu.Lock()
+	bag.m[key] = value
+	bag.mu.Unlock()
+}
+
+// Get returns the value stored under key with Set or by a ValueExtractor.
+func Get(r *http.Request, key string) (interface{}, bool) {
+	bag, ok := r.Context().Value(valuesKey).(*values)
+	if !ok {
+		return nil, false
+	}
+	bag.mu.RLock()
+	defer bag.mu.RUnlock()
+	v, ok := bag.m[key]
+	return v, ok
+}
+
+// contextValues returns a copy of the request's value bag.
+func contextValues(r *http.Request) map[string]interface{} {
+	bag, ok := r.Context().Value(valuesKey).(*values)
+	if !ok {
+		return map[string]interface{}{}
+	}
+	bag.mu.RLock()
+	defer bag.mu.RUnlock()
+	m := make(map[string]interface{}, len(bag.m))
+	for k, v := range bag.m {
+		m[k] = v
+	}
+	return m
+}
+
+// ValueExtractor pulls a named value out of a request for
+// ContextValueHandler. It returns an empty key when the request carries no
+// such value.
+type ValueExtractor func(r *http.Request) (key string, value interface{})
+
+// ContextValueHandler runs extractors on each request and stores the values
+// they find in the request's value bag, readable with Get and ContextString,
+// so handlers need not repeat the extraction. Like everything in the bag the
+// values appear in the request log line. It installs a bag when the request
+// has none.
+func ContextValueHandler(extractors ...ValueExtractor) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			for _, extract := range extractors {
+				if key, value := extract(r); key != "" {
+					Set(r, key, value)
+				}
+			}
+			h.ServeHTTP(w, r)
+		}
+		return ValuesHandler(http.HandlerFunc(f))
+	}
+}
+
+// ContextString returns the value stored under key as a string, or "" when
+// it is missing or not a string.
+func ContextString(r *http.Request, key string) string {
+	v, _ := Get(r, key)
+	s, _ := v.(string)
+	return s
+}
+
+// HeaderExtractor stores the value of the request header under key, e.g.
+// HeaderExtractor("tenant", "X-Tenant-ID").
+func HeaderExtractor(key, header string) ValueExtractor {
+	return func(r *http.Request) (string, interface{}) {
+		if v := r.Header.Get(header); v != "" {
+			return key, v
+		}
+		return "", nil
+	}
+}
+
+// SubdomainExtractor stores the label of the request host directly below
+// domain under key, e.g. "acme" for acme.example.com with domain
+// "example.com".
+func SubdomainExtractor(key, domain string) ValueExtractor {
+	suffix := "." + strings.ToLower(strings.TrimPrefix(domain, "."))
+	return func(r *http.Request) (string, interface{}) {
+		host := requestHost(r)
+		if !strings.HasSuffix(host, suffix) {
+			return "", nil
+		}
+		sub := strings.TrimSuffix(host, suffix)
+		if i := strings.LastIndexByte(sub, '.'); i >= 0 {
+			sub = sub[i+1:]
+		}
+		return key, sub
+	}
+}
@@ -0,0 +1,62 @@
+package goweb
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+var debugPage = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Panic: {{ .Error }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f6f6f6; padding: 1em; overflow-x: auto; }
+th { text-align: left; padding-right: 1em; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Panic: {{ .Error }}</h1>
+<p>{{ .Method }} {{ .URI }}{{ if .Handler }} in <code>{{ .Handler }}</code>{{ end }}</p>
+<h2>Stack trace</h2>
+<pre>{{ .Stack }}</pre>
+<h2>Request headers</h2>
+<table>
+{{ range $name, $values := .Header }}<tr><th>{{ $name }}</th><td>{{ range $values }}{{ . }}<br>{{ end }}</td></tr>
+{{ end }}</table>
+</body>
+</html>
+`))
+
+// writeDebugPage responds with a 500 page describing the panic. It must only
+// be used in dev mode since it exposes the stack trace and request headers.
+func writeDebugPage(w http.ResponseWriter, r *http.Request, err error, stack []byte) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	debugPage.Execute(w, map[string]interface{}{
+		"Error":   err.Error(),
+		"Method":  r.Method,
+		"URI":     r.RequestURI,
+		"Handler": panickingFunc(stack),
+		"Stack":   string(stack),
+		"Header":  r.Header,
+	})
+}
+
+// panickingFunc returns the function that panicked, read from the frame after
+// the runtime panic call in a debug.Stack trace.
+func panickingFunc(stack []byte) string {
+	lines := strings.Split(string(stack), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic(") && i+3 < len(lines) {
+			fn := lines[i+2]
+			if j := strings.LastIndex(fn, "("); j > 0 {
+				fn = fn[:j]
+			}
+			return fn
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package goweb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ServeDownload streams content to the client as a file attachment named
+// filename, prompting the browser to save it.
+func ServeDownload(w http.ResponseWriter, r *http.Request, filename string, content io.Reader, contentType string) error {
+	return serveFile(w, r, "attachment", filename, content, contentType)
+}
+
+// ServeInline streams content for the browser to display, such as a PDF,
+// while still naming it filename should the user save it.
+func ServeInline(w http.ResponseWriter, r *http.Request, filename string, content io.Reader, contentType string) error {
+	return serveFile(w, r, "inline", filename, content, contentType)
+}
+
+func serveFile(w http.ResponseWriter, r *http.Request, disposition, filename string, content io.Reader, contentType string) error {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err := io.Copy(w, content)
+	return err
+}
+
+// contentDisposition builds a Content-Disposition header value. Names that
+// are not plain ASCII get an ASCII filename fallback for old clients and an
+// RFC 5987 encoded filename* with the exact name.
+func contentDisposition(disposition, filename string) string {
+	var fallback strings.Builder
+	plain := true
+	for _, c := range filename {
+		switch {
+		case c < 0x20 || c == 0x7f:
+			// drop control characters, they could split the header
+			plain = false
+		case c > 0x7e, c == '"', c == '\\', c == '/':
+			fallback.WriteByte('_')
+			plain = false
+		default:
+			fallback.WriteRune(c)
+		}
+	}
+
+	name := fallback.String()
+	if strings.Trim(name, "_. ") == "" {
+		name = "download"
+	}
+
+	value := fmt.Sprintf(`%s; filename="%s"`, disposition, name)
+	if !plain {
+		value += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return value
+}
+
+// encodeRFC5987 percent-encodes s as the value of an RFC 5987 ext-value.
+func encodeRFC5987(s string) string {
+	const attrChars = "!#$&+-.^_`|~"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.IndexByte(attrChars, c) >= 0:
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			// control characters never belong in a file name
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,27 @@
+package goweb
+
+import "testing"
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		disposition, filename, want string
+	}{
+		{"attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"inline", "Q3 report.pdf", `inline; filename="Q3 report.pdf"`},
+		{"attachment", "résumé.pdf", `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+		{"attachment", "日本.txt", `attachment; filename="__.txt"; filename*=UTF-8''%E6%97%A5%E6%9C%AC.txt`},
+		{"attachment", `say "hi".txt`, `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{"attachment", `a\b.txt`, `attachment; filename="a_b.txt"; filename*=UTF-8''a%5Cb.txt`},
+		{"attachment", "../etc/passwd", `attachment; filename=".._etc_passwd"; filename*=UTF-8''..%2Fetc%2Fpasswd`},
+		{"attachment", "evil\r\nSet-Cookie: x.txt", `attachment; filename="evilSet-Cookie: x.txt"; filename*=UTF-8''evilSet-Cookie%3A%20x.txt`},
+		{"attachment", "日本", `attachment; filename="download"; filename*=UTF-8''%E6%97%A5%E6%9C%AC`},
+		{"attachment", "/", `attachment; filename="download"; filename*=UTF-8''%2F`},
+		{"attachment", "..", `attachment; filename="download"`},
+		{"attachment", "", `attachment; filename="download"`},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition(tt.disposition, tt.filename); got != tt.want {
+			t.Errorf("contentDisposition(%q, %q) =\n%s\nwant\n%s", tt.disposition, tt.filename, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package goweb
+
+import (
+	"hash/fnv"
+	"net/http"
+)
+
+// flagsValueKey is the value bag key the flag set is stored under, so
+// templates can read it as .ctx.flags.
+const flagsValueKey = "flags"
+
+// FlagSet holds the feature flags evaluated for a request.
+type FlagSet map[string]bool
+
+// Enabled reports whether the flag is on. Unknown flags are off.
+func (f FlagSet) Enabled(name string) bool {
+	return f[name]
+}
+
+// FlagProvider evaluates the feature flags for a request, e.g. from the
+// current user, a cookie, a header or a configuration service.
+type FlagProvider interface {
+	Flags(r *http.Request) FlagSet
+}
+
+// FlagProviderFunc adapts a function to a FlagProvider.
+type FlagProviderFunc func(r *http.Request) FlagSet
+
+func (f FlagProviderFunc) Flags(r *http.Request) FlagSet {
+	return f(r)
+}
+
+// FeatureFlagsHandler evaluates the flags from provider once per request and
+// stores them in the request's value bag, readable with Flags and, in
+// templates rendered with Render, as .ctx.flags. Install it after the
+// middleware that identifies the user if flags depend on them.
+func FeatureFlagsHandler(provider FlagProvider) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			flags := provider.Flags(r)
+			if flags == nil {
+				flags = FlagSet{}
+			}
+			Set(r, flagsValueKey, flags)
+			h.ServeHTTP(w, r)
+		}
+		return ValuesHandler(http.HandlerFunc(f))
+	}
+}
+
+// Flags returns the flags evaluated by FeatureFlagsHandler. It returns an
+// empty set, with every flag off, when the handler did not run.
+func Flags(r *http.Request) FlagSet {
+	v, _ := Get(r, flagsValueKey)
+	flags, _ := v.(FlagSet)
+	if flags == nil {
+		return FlagSet{}
+	}
+	return flags
+}
+
+// InRollout reports whether id, such as a user ID or a cookie value, falls in
+// the first percent of the population for flag. The bucket is a hash of flag
+// and id, so an id keeps its answer across requests and servers, and raising
+// percent only ever adds ids.
+func InRollout(flag, id string, percent int) bool {
+	if percent <= 0 {
+		return false
+	}
+	if percent >= 100 {
+		return true
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(flag))
+	hash.Write([]byte{0})
+	hash.Write([]byte(id))
+	return int(hash.Sum32()%100) < percent
+}
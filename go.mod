@@ -3,8 +3,13 @@ module github.com/phil-inc/goweb
 go 1.21
 
 require (
-	github.com/justinas/alice v1.2.0 // indirect
-	github.com/phil-inc/plog-ng v0.0.0-20231004041514-20c7ee416f4a // indirect
+	github.com/justinas/alice v1.2.0
+	github.com/phil-inc/plog-ng v0.0.0-20231004041514-20c7ee416f4a
+	golang.org/x/net v0.17.0
+	golang.org/x/text v0.14.0
+)
+
+require (
 	github.com/sirupsen/logrus v1.9.0 // indirect
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
@@ -0,0 +1,55 @@
+package goweb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	logger "github.com/phil-inc/plog-ng/pkg/core"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	os.Exit(m.Run())
+}
+
+// withSettings makes the settings of cfg the defaults, used by requests that
+// do not pass through handler, for the rest of the test.
+func withSettings(t *testing.T, cfg Config) {
+	t.Helper()
+	prev := defaultSettings.Load()
+	defaultSettings.Store(newSettings(cfg))
+	t.Cleanup(func() { defaultSettings.Store(prev) })
+}
+
+// withTemplates runs the test from a temporary directory holding files under
+// views/templates, where Render looks for templates.
+func withTemplates(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, "views", "templates", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// resetPartials drops the partials registered by the test when it ends.
+func resetPartials(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() { partials.set.Store(&partialSet{tmpl: newPartials()}) })
+}
@@ -2,18 +2,24 @@ package goweb
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
 var helperFuncs = template.FuncMap{
 	"assetPath": assetPath,
+	"urlFor":    urlFor,
 	"stylesheetTag": func(file string) template.HTML {
 		return css(file)
 	},
@@ -42,30 +48,135 @@ func (m *stringMap) Store(key string, value string) {
 	m.data.Store(key, value)
 }
 
+// addVary adds value to the Vary header, keeping any values already present.
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, token := range strings.Split(v, ",") {
+			token = strings.TrimSpace(token)
+			if token == "*" || strings.EqualFold(token, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// acceptsMediaType reports whether an Accept header value explicitly lists
+// mediaType with a non-zero quality.
+func acceptsMediaType(accept, mediaType string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), mediaType) {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+			if q, ok := strings.CutPrefix(param, "q="); ok && strings.Trim(q, "0.") == "" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 func assetPath(file string) (string, error) {
 	return assetPathFor(file), nil
 }
 
 func assetPathFor(file string) string {
+	return assetPathUnder(defaultSettings.Load().assetsRoot, file)
+}
+
+// assetPathUnder returns the URL path of file, fingerprinted when the
+// manifest lists it, under root.
+func assetPathUnder(root, file string) string {
 	filePath, ok := assetMap.Load(file)
 	if filePath == "" || !ok {
 		filePath = file
 	}
-	return filepath.ToSlash(filepath.Join("/public/assets", filePath))
+	return filepath.ToSlash(filepath.Join(root, filePath))
 }
 
+// MaxManifestSize is the largest asset manifest loadManifest accepts, and
+// ManifestReadTimeout the longest it waits for one to be read, e.g. from a
+// stalled network mount or pipe fed by build tooling.
+var (
+	MaxManifestSize     int64 = 5 << 20
+	ManifestReadTimeout       = 10 * time.Second
+)
+
 func loadManifest(manifest io.Reader) error {
-	m := map[string]string{}
+	data, err := readManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > MaxManifestSize {
+		return fmt.Errorf("goweb: manifest exceeds %d bytes", MaxManifestSize)
+	}
 
-	if err := json.NewDecoder(manifest).Decode(&m); err != nil {
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("goweb: manifest must be a JSON object of strings: %w", err)
+		}
 		return err
 	}
+	if m == nil {
+		// a literal null unmarshals without error
+		return errors.New("goweb: manifest must be a JSON object of strings, not null")
+	}
 	for k, v := range m {
 		assetMap.Store(k, v)
 	}
 	return nil
 }
 
+// readManifest reads up to one byte more than MaxManifestSize from manifest,
+// giving up after ManifestReadTimeout. A read that times out is left to
+// finish in the background.
+func readManifest(manifest io.Reader) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := io.ReadAll(io.LimitReader(manifest, MaxManifestSize+1))
+		done <- result{data, err}
+	}()
+
+	timer := time.NewTimer(ManifestReadTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res.data, res.err
+	case <-timer.C:
+		return nil, fmt.Errorf("goweb: reading manifest timed out after %s", ManifestReadTimeout)
+	}
+}
+
+// LoadManifestFile loads the asset manifest at path, mapping asset names to
+// their fingerprinted file names. A missing manifest is not an error: assets
+// then resolve to their plain names, which is the usual state in development.
+// A manifest that exists but cannot be parsed is reported.
+func LoadManifestFile(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := loadManifest(f); err != nil {
+		return fmt.Errorf("goweb: loading manifest %s: %w", path, err)
+	}
+	return nil
+}
+
 func css(file string) template.HTML {
 	filePath, ok := assetMap.Load(file)
 	if filePath == "" || !ok {
@@ -115,3 +226,59 @@ func DirectoryPath() string {
 	}
 	return viewsDirPath
 }
+
+// ClientIP returns the IP address of the client that sent the request. With
+// no trusted proxies it is the connection's remote address. Behind N trusted
+// proxies it is the (N+1)th entry from the right of X-Forwarded-For: the last
+// N entries are skipped as written by the trusted proxies, and entries
+// further left were supplied by the client and cannot be trusted. When that
+// entry is missing or is not an IP address, the remote address is used.
+func ClientIP(r *http.Request) string {
+	if trustedProxyCount := settingsFor(r).trustedProxyCount; trustedProxyCount > 0 {
+		var entries []string
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			entries = append(entries, strings.Split(v, ",")...)
+		}
+		if i := len(entries) - trustedProxyCount - 1; i >= 0 {
+			if ip := parseForwardedIP(entries[i]); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// parseForwardedIP parses an X-Forwarded-For entry, which some proxies write
+// with a port, returning nil when it is not an IP address.
+func parseForwardedIP(entry string) net.IP {
+	entry = strings.TrimSpace(entry)
+	if host, _, err := net.SplitHostPort(entry); err == nil {
+		entry = host
+	}
+	return net.ParseIP(entry)
+}
+
+// IsSafeMethod reports whether the request uses a safe method (GET, HEAD,
+// OPTIONS or TRACE), i.e. one that should not change server state.
+func IsSafeMethod(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// IsIdempotentMethod reports whether the request uses an idempotent method.
+// These are the safe methods plus PUT and DELETE.
+func IsIdempotentMethod(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return IsSafeMethod(r)
+}
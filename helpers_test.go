@@ -0,0 +1,169 @@
+package goweb
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		wantErr  string
+	}{
+		{"valid", `{"app.css":"app-1a2b.css"}`, ""},
+		{"empty object", `{}`, ""},
+		{"null", `null`, "not null"},
+		{"array", `["app.css"]`, "JSON object of strings"},
+		{"number values", `{"app.css":1}`, "JSON object of strings"},
+		{"malformed", `{"app.css":`, "unexpected end"},
+		{"oversize", `{"a":"` + strings.Repeat("x", int(MaxManifestSize)) + `"}`, "exceeds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadManifest(strings.NewReader(tt.manifest))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadManifestTimeout(t *testing.T) {
+	defer func(d time.Duration) { ManifestReadTimeout = d }(ManifestReadTimeout)
+	ManifestReadTimeout = 50 * time.Millisecond
+
+	// a reader whose writer never writes
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	err := loadManifest(pr)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("error = %v, want a timeout", err)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies int
+		xff     []string
+		want    string
+	}{
+		{"no proxies ignores header", 0, []string{"1.1.1.1"}, "10.0.0.1"},
+		{"one proxy", 1, []string{"1.1.1.1, 2.2.2.2"}, "1.1.1.1"},
+		{"one proxy ignores spoofed prefix", 1, []string{"6.6.6.6, 1.1.1.1, 2.2.2.2"}, "1.1.1.1"},
+		{"two proxies", 2, []string{"1.1.1.1, 2.2.2.2, 3.3.3.3"}, "1.1.1.1"},
+		{"split across headers", 2, []string{"1.1.1.1", "2.2.2.2, 3.3.3.3"}, "1.1.1.1"},
+		{"too few entries", 2, []string{"2.2.2.2, 3.3.3.3"}, "10.0.0.1"},
+		{"untrimmed entries", 1, []string{"  1.1.1.1  ,2.2.2.2"}, "1.1.1.1"},
+		{"entry with port", 1, []string{"1.1.1.1:4711, 2.2.2.2"}, "1.1.1.1"},
+		{"ipv6", 1, []string{"[2001:db8::1]:4711, 2.2.2.2"}, "2001:db8::1"},
+		{"garbage", 1, []string{"<script>, 2.2.2.2"}, "10.0.0.1"},
+		{"empty entry", 1, []string{", 2.2.2.2"}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSettings(t, Config{TrustedProxyCount: tt.proxies})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "10.0.0.1:5000"
+			r.Header["X-Forwarded-For"] = tt.xff
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadManifestFile(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := LoadManifestFile(filepath.Join(dir, "missing.json")); err != nil {
+		t.Errorf("missing manifest: %v", err)
+	}
+	if got := assetPathFor("unfingerprinted.js"); got != "/public/assets/unfingerprinted.js" {
+		t.Errorf("asset without a manifest resolved to %s", got)
+	}
+
+	malformed := filepath.Join(dir, "malformed.json")
+	if err := os.WriteFile(malformed, []byte(`{"site.js":`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadManifestFile(malformed); err == nil || !strings.Contains(err.Error(), malformed) {
+		t.Errorf("malformed manifest: error = %v, want one naming the file", err)
+	}
+
+	valid := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(valid, []byte(`{"site.js":"site-9f8e.js"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadManifestFile(valid); err != nil {
+		t.Fatal(err)
+	}
+	if got := assetPathFor("site.js"); got != "/public/assets/site-9f8e.js" {
+		t.Errorf("fingerprinted asset resolved to %s", got)
+	}
+}
+
+func TestAssetPathRoot(t *testing.T) {
+	tests := []struct {
+		name, root, want string
+	}{
+		{"default", "", "/public/assets/logo.svg"},
+		{"custom", "/static", "/static/logo.svg"},
+		{"trailing slash", "/assets/v3/", "/assets/v3/logo.svg"},
+		{"no leading slash", "cdn-assets", "/cdn-assets/logo.svg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler(Config{Router: NewRouter(), AssetsRoot: tt.root})
+			got, err := assetPath("logo.svg")
+			if err != nil || got != tt.want {
+				t.Errorf("assetPath = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	// a Config without a root resets the one set by an earlier Config
+	handler(Config{Router: NewRouter(), AssetsRoot: "/static"})
+	handler(Config{Router: NewRouter()})
+	if got := assetPathFor("logo.svg"); got != "/public/assets/logo.svg" {
+		t.Errorf("after a Config without AssetsRoot: %s", got)
+	}
+}
+
+func TestMethodPredicates(t *testing.T) {
+	tests := []struct {
+		method           string
+		safe, idempotent bool
+	}{
+		{http.MethodGet, true, true},
+		{http.MethodHead, true, true},
+		{http.MethodOptions, true, true},
+		{http.MethodTrace, true, true},
+		{http.MethodPut, false, true},
+		{http.MethodDelete, false, true},
+		{http.MethodPost, false, false},
+		{http.MethodPatch, false, false},
+		{http.MethodConnect, false, false},
+		{"get", false, false},
+	}
+	for _, tt := range tests {
+		r := &http.Request{Method: tt.method}
+		if got := IsSafeMethod(r); got != tt.safe {
+			t.Errorf("IsSafeMethod(%s) = %v", tt.method, got)
+		}
+		if got := IsIdempotentMethod(r); got != tt.idempotent {
+			t.Errorf("IsIdempotentMethod(%s) = %v", tt.method, got)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package goweb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// JSONEncoder is implemented by *json.Encoder. Other JSON libraries can be
+// plugged in through JSONOptions.NewEncoder.
+type JSONEncoder interface {
+	Encode(v interface{}) error
+}
+
+// JSONOptions controls how JSON writes responses. The zero value matches
+// encoding/json defaults.
+type JSONOptions struct {
+	// DisableHTMLEscape stops <, > and & being escaped inside strings.
+	DisableHTMLEscape bool
+
+	// Indent, when set, pretty-prints output using it as the indent.
+	Indent string
+
+	// NewEncoder replaces encoding/json. DisableHTMLEscape and Indent are
+	// ignored when it is set.
+	NewEncoder func(w io.Writer) JSONEncoder
+}
+
+func (o JSONOptions) encoder(w io.Writer) JSONEncoder {
+	if o.NewEncoder != nil {
+		return o.NewEncoder(w)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(!o.DisableHTMLEscape)
+	if o.Indent != "" {
+		enc.SetIndent("", o.Indent)
+	}
+	return enc
+}
+
+// JSON encodes v and writes it as the response with the given status, using
+// the Config.JSONOptions of the most recently started server; JSON has no
+// request to tell servers apart by, so an app running servers with different
+// options should use JSONWithOptions. v is encoded before anything is
+// written, so if encoding fails no partial JSON is sent: the error is logged,
+// the response is a bare 500 and the error is returned.
+func JSON(w http.ResponseWriter, status int, v interface{}) error {
+	return JSONWithOptions(w, status, v, defaultSettings.Load().jsonOptions)
+}
+
+// requestJSON is JSON with the options of the server serving r.
+func requestJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	return JSONWithOptions(w, status, v, settingsFor(r).jsonOptions)
+}
+
+// JSONWithOptions is like JSON but uses opts instead of the configured options.
+func JSONWithOptions(w http.ResponseWriter, status int, v interface{}, opts JSONOptions) error {
+	var buf bytes.Buffer
+	if err := opts.encoder(&buf).Encode(v); err != nil {
+		logErrorAndRespond(w, "error encoding json", err)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// streamFlushEvery is how many elements StreamJSON writes between flushes.
+const streamFlushEvery = 64
+
+// StreamJSON writes the values received from ch as a JSON array, one element
+// at a time, so large collections never have to be held in memory and the
+// client gets the first bytes early. The array is closed when ch is closed,
+// and also when an element fails to encode, so the output is always valid
+// JSON; the encoding error is returned. StreamJSON stops reading ch at that
+// point, so producers should also watch the request context to avoid
+// blocking forever. Responses are only flushed early when the writer
+// supports it: behind TimeoutHandler, which buffers the whole response, the
+// path must be listed in Config.StreamingPaths.
+func StreamJSON(w http.ResponseWriter, status int, ch <-chan interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	opts := defaultSettings.Load().jsonOptions
+	flusher, _ := w.(http.Flusher)
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	var encErr error
+	n := 0
+	for v := range ch {
+		buf.Reset()
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		if err := opts.encoder(&buf).Encode(v); err != nil {
+			encErr = err
+			break
+		}
+		if _, err := w.Write(bytes.TrimRight(buf.Bytes(), "\n")); err != nil {
+			return err
+		}
+
+		n++
+		if flusher != nil && n%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+
+	if _, err := io.WriteString(w, "]"); err != nil {
+		return err
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return encErr
+}
+
+// ErrorResponder writes the response for a request that failed with err.
+type ErrorResponder func(w http.ResponseWriter, r *http.Request, err error)
+
+func defaultBodyTooLargeResponder(w http.ResponseWriter, r *http.Request, err error) {
+	requestJSON(w, r, http.StatusRequestEntityTooLarge, map[string]string{"error": "request body too large"})
+}
+
+func defaultDecodeErrorResponder(w http.ResponseWriter, r *http.Request, err error) {
+	requestJSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+}
+
+// BindJSON decodes the request body into v. On failure it logs the error,
+// sends the configured 413 response if the body exceeded the limit set by
+// MaxBodyHandler or the configured 400 response otherwise, and returns the
+// error so the handler can simply return.
+func BindJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	log.Printf("Error decoding request body: %s %s %s", r.Method, r.RequestURI, err)
+
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		settingsFor(r).bodyTooLargeResponder(w, r, err)
+	} else {
+		settingsFor(r).decodeErrorResponder(w, r, err)
+	}
+	return err
+}
+
+// MaxBodyHandler limits request bodies to n bytes. Reads past the limit fail
+// with an *http.MaxBytesError, which BindJSON answers with a 413.
+func MaxBodyHandler(n int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, n)
+			}
+			h.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(f)
+	}
+}
+
+// RequireJSONHandler rejects unsafe requests, such as POST, PUT, PATCH and
+// DELETE, with a body whose Content-Type is not application/json or a +json
+// type with a 415, so a form post to an API gets a clear answer instead of a
+// decode error.
+// Parameters such as charset are ignored. Use it on a route with Route.Use to
+// apply it to only some endpoints.
+func RequireJSONHandler(h http.Handler) http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		if !IsSafeMethod(r) && r.ContentLength != 0 && !isJSONContentType(r.Header.Get("Content-Type")) {
+			requestJSON(w, r, http.StatusUnsupportedMediaType, map[string]string{"error": "content type must be application/json"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(f)
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
@@ -0,0 +1,123 @@
+package goweb
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamJSONFlushesThroughChain(t *testing.T) {
+	release := make(chan struct{})
+	router := NewRouter()
+	router.GET("/stream", func(w http.ResponseWriter, r *http.Request) {
+		ch := make(chan interface{})
+		go func() {
+			defer close(ch)
+			for i := 0; i < streamFlushEvery; i++ {
+				ch <- i
+			}
+			<-release
+		}()
+		StreamJSON(w, http.StatusOK, ch)
+	})
+
+	srv := httptest.NewServer(handler(Config{Router: router, StreamingPaths: []string{"/stream"}}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	// the first elements must arrive while the handler is still producing
+	body := bufio.NewReader(res.Body)
+	first := make(chan error, 1)
+	go func() {
+		_, err := body.Peek(1)
+		first <- err
+	}()
+	select {
+	case err := <-first:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		close(release)
+		t.Fatal("no bytes reached the client before the stream ended")
+	}
+	close(release)
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", data, err)
+	}
+	if len(got) != streamFlushEvery {
+		t.Errorf("got %d elements, want %d", len(got), streamFlushEvery)
+	}
+}
+
+func TestJSONEncodingError(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := JSON(w, http.StatusCreated, map[string]interface{}{"bad": make(chan int)})
+
+	if err == nil {
+		t.Fatal("expected an encoding error")
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("partial output written: %q", w.Body.String())
+	}
+}
+
+func TestJSONWithOptions(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := JSONWithOptions(w, http.StatusCreated, map[string]string{"a": "<b>"}, JSONOptions{DisableHTMLEscape: true}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusCreated || w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Errorf("got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := w.Body.String(); got != "{\"a\":\"<b>\"}\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestRequireJSONHandler(t *testing.T) {
+	h := RequireJSONHandler(http.HandlerFunc(reply("ok")))
+	tests := []struct {
+		method, contentType, body string
+		want                      int
+	}{
+		{http.MethodPost, "application/json; charset=utf-8", `{}`, http.StatusOK},
+		{http.MethodPatch, "application/merge-patch+json", `{}`, http.StatusOK},
+		{http.MethodPost, "application/x-www-form-urlencoded", "a=1", http.StatusUnsupportedMediaType},
+		{http.MethodPut, "text/plain", "a", http.StatusUnsupportedMediaType},
+		{http.MethodDelete, "text/plain", "a", http.StatusUnsupportedMediaType},
+		{http.MethodDelete, "", "", http.StatusOK},
+		{http.MethodPost, "", "", http.StatusOK},
+		{http.MethodGet, "text/plain", "a", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %q: status = %d, want %d", tt.method, tt.contentType, w.Code, tt.want)
+		}
+	}
+}
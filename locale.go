@@ -0,0 +1,111 @@
+package goweb
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// LocaleHandler picks the best of supported for each request's
+// Accept-Language header and stores it for Locale and the locale-aware
+// template functions. The first supported tag is the default.
+func LocaleHandler(supported ...language.Tag) func(http.Handler) http.Handler {
+	matcher := language.NewMatcher(supported)
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			tags, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+			_, i, _ := matcher.Match(tags...)
+			ctx := context.WithValue(r.Context(), localeKey, supported[i])
+			h.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(f)
+	}
+}
+
+// Locale returns the locale of the request: the one chosen by LocaleHandler,
+// else the client's preferred Accept-Language, else English.
+func Locale(r *http.Request) language.Tag {
+	if tag, ok := r.Context().Value(localeKey).(language.Tag); ok {
+		return tag
+	}
+	if tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language")); err == nil && len(tags) > 0 {
+		return tags[0]
+	}
+	return language.English
+}
+
+// localeFuncs returns the template functions that format values for tag:
+//
+//	{{ number .N }}                 1,234.5 or 1.234,5
+//	{{ currency .Amount "EUR" }}    € 1,234.50
+//	{{ date .T "medium" }}          Jan 2, 2006 or 02.01.2006
+func localeFuncs(tag language.Tag) template.FuncMap {
+	p := message.NewPrinter(tag)
+	return template.FuncMap{
+		"number": func(n interface{}) string {
+			return p.Sprint(number.Decimal(n))
+		},
+		"currency": func(amount interface{}, code string) (string, error) {
+			unit, err := currency.ParseISO(code)
+			if err != nil {
+				return "", err
+			}
+			return p.Sprint(currency.Symbol(unit.Amount(amount))), nil
+		},
+		"date": func(t time.Time, style string) (string, error) {
+			layout, err := dateLayout(tag, style)
+			if err != nil {
+				return "", err
+			}
+			return t.Format(layout), nil
+		},
+	}
+}
+
+// dateLayouts holds the short, medium, long and full date layouts by field
+// order. Month and day names can only be spelled out in English, so other
+// languages use numeric dates in their conventional order.
+var dateLayouts = map[string]map[string]string{
+	"en-US": {"short": "1/2/06", "medium": "Jan 2, 2006", "long": "January 2, 2006", "full": "Monday, January 2, 2006"},
+	"en":    {"short": "02/01/2006", "medium": "2 Jan 2006", "long": "2 January 2006", "full": "Monday, 2 January 2006"},
+	"dmy":   {"short": "02/01/06", "medium": "02/01/2006", "long": "02/01/2006", "full": "02/01/2006"},
+	"dmy.":  {"short": "02.01.06", "medium": "02.01.2006", "long": "02.01.2006", "full": "02.01.2006"},
+	"ymd":   {"short": "06/01/02", "medium": "2006/01/02", "long": "2006/01/02", "full": "2006/01/02"},
+	"iso":   {"short": "2006-01-02", "medium": "2006-01-02", "long": "2006-01-02", "full": "2006-01-02"},
+}
+
+func dateLayout(tag language.Tag, style string) (string, error) {
+	base, _ := tag.Base()
+	region, _ := tag.Region()
+
+	var key string
+	switch base.String() {
+	case "en":
+		key = "en"
+		switch region.String() {
+		case "US", "ZZ", "PH":
+			key = "en-US"
+		}
+	case "de", "ru", "pl", "cs", "fi", "nb", "da", "tr", "uk":
+		key = "dmy."
+	case "ja", "zh", "ko", "hu":
+		key = "ymd"
+	case "sv", "lt":
+		key = "iso"
+	default:
+		key = "dmy"
+	}
+
+	layout, ok := dateLayouts[key][style]
+	if !ok {
+		return "", fmt.Errorf("goweb: unknown date style %q", style)
+	}
+	return layout, nil
+}
@@ -0,0 +1,69 @@
+package goweb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+func TestLocaleFuncs(t *testing.T) {
+	day := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		tag                    string
+		number, currency, date string
+	}{
+		{"en", "1,234.5", "€ 1,234.50", "Mar 5, 2024"},
+		{"en-US", "1,234.5", "€ 1,234.50", "Mar 5, 2024"},
+		{"en-GB", "1,234.5", "€ 1,234.50", "5 Mar 2024"},
+		{"de", "1.234,5", "€ 1.234,50", "05.03.2024"},
+		{"ja", "1,234.5", "€ 1,234.50", "2024/03/05"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			funcs := localeFuncs(language.MustParse(tt.tag))
+			number := funcs["number"].(func(interface{}) string)
+			currency := funcs["currency"].(func(interface{}, string) (string, error))
+			date := funcs["date"].(func(time.Time, string) (string, error))
+
+			if got := number(1234.5); got != tt.number {
+				t.Errorf("number = %q, want %q", got, tt.number)
+			}
+			if got, err := currency(1234.5, "EUR"); err != nil || got != tt.currency {
+				t.Errorf("currency = %q, %v; want %q", got, err, tt.currency)
+			}
+			if got, err := date(day, "medium"); err != nil || got != tt.date {
+				t.Errorf("date = %q, %v; want %q", got, err, tt.date)
+			}
+			if _, err := currency(1, "euro"); err == nil {
+				t.Error("currency accepted an invalid ISO code")
+			}
+		})
+	}
+}
+
+func TestDateLayout(t *testing.T) {
+	tests := []struct {
+		tag, style, want, wantErr string
+	}{
+		{"en", "short", "1/2/06", ""},
+		{"en-US", "full", "Monday, January 2, 2006", ""},
+		{"en-GB", "long", "2 January 2006", ""},
+		{"de", "short", "02.01.06", ""},
+		{"de", "full", "02.01.2006", ""},
+		{"ja", "medium", "2006/01/02", ""},
+		{"fr", "medium", "02/01/2006", ""},
+		{"de", "fancy", "", `unknown date style "fancy"`},
+		{"ja", "", "", "unknown date style"},
+	}
+	for _, tt := range tests {
+		got, err := dateLayout(language.MustParse(tt.tag), tt.style)
+		switch {
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s %s: error = %v, want one containing %q", tt.tag, tt.style, err, tt.wantErr)
+		case tt.wantErr == "" && (err != nil || got != tt.want):
+			t.Errorf("%s %s = %q, %v; want %q", tt.tag, tt.style, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package goweb
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var maintenance atomic.Bool
+
+// SetMaintenance turns maintenance mode on or off. While it is on,
+// MaintenanceHandler answers requests with a 503. It is safe to call
+// from any goroutine.
+func SetMaintenance(on bool) {
+	maintenance.Store(on)
+}
+
+// InMaintenance reports whether maintenance mode is on.
+func InMaintenance() bool {
+	return maintenance.Load()
+}
+
+// MaintenanceConfig controls the response served during maintenance.
+type MaintenanceConfig struct {
+	// AllowPaths are served normally during maintenance, e.g. health checks.
+	AllowPaths []string
+
+	// AllowIPs are client IPs, such as admin machines, that are served
+	// normally during maintenance.
+	AllowIPs []string
+
+	// RetryAfter is sent in the Retry-After header. Defaults to 5 minutes.
+	RetryAfter time.Duration
+
+	// Template is a template file, relative to the templates directory,
+	// rendered as the maintenance page. A plain text page is sent when empty.
+	Template string
+}
+
+// MaintenanceHandler serves a 503 maintenance page while SetMaintenance(true)
+// is in effect, except for allow-listed paths and client IPs.
+func MaintenanceHandler(c MaintenanceConfig) func(http.Handler) http.Handler {
+	retryAfter := c.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = 5 * time.Minute
+	}
+
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			if !InMaintenance() || containsString(c.AllowPaths, r.URL.Path) || containsString(c.AllowIPs, ClientIP(r)) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			if c.Template == "" {
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+
+			var buf bytes.Buffer
+			if err := renderTemplates(&buf, false, settingsFor(r).strictTemplateVars, requestFuncs(r), map[string]interface{}{}, c.Template); err != nil {
+				logErrorAndRespond(w, "error executing maintenance template", err)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			buf.WriteTo(w)
+		}
+		return http.HandlerFunc(f)
+	}
+}
@@ -0,0 +1,178 @@
+package goweb
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AllowedHostsHandler rejects requests whose Host header does not match one
+// of hosts with a 400, protecting handlers that build absolute URLs from the
+// Host header. A pattern of "*.example.com" matches any subdomain of
+// example.com, ".example.com" matches example.com and its subdomains, and
+// "*" matches everything. Requests for exemptPaths, such as health checks,
+// are always let through.
+func AllowedHostsHandler(hosts []string, exemptPaths ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			if !containsString(exemptPaths, r.URL.Path) && !hostAllowed(requestHost(r), hosts) {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			h.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(f)
+	}
+}
+
+// CanonicalHostHandler lowercases the request's Host and drops the default
+// port of the request's scheme (:80 for http, :443 for https), so
+// Example.COM:443 on a TLS connection becomes example.com before host checks,
+// host-based routing or absolute URL construction see it. Other ports are
+// kept. Behind TrustedProxyCount proxies the scheme is taken from
+// X-Forwarded-Proto.
+func CanonicalHostHandler(h http.Handler) http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		r.Host = canonicalHost(r.Host, requestScheme(r))
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(f)
+}
+
+func canonicalHost(host, scheme string) string {
+	host = strings.ToLower(host)
+	defaultPort := "80"
+	if scheme == "https" {
+		defaultPort = "443"
+	}
+	if h, port, err := net.SplitHostPort(host); err == nil && port == defaultPort {
+		if strings.Contains(h, ":") {
+			// keep the brackets of an IPv6 literal
+			return "[" + h + "]"
+		}
+		return h
+	}
+	return host
+}
+
+// requestScheme returns "https" when r arrived over TLS or, behind trusted
+// proxies, when the nearest proxy reports it did, and "http" otherwise.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if settingsFor(r).trustedProxyCount > 0 {
+		protos := strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")
+		if strings.EqualFold(strings.TrimSpace(protos[len(protos)-1]), "https") {
+			return "https"
+		}
+	}
+	return "http"
+}
+
+// requestHost returns the lowercased host of r without its port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
+
+func hostAllowed(host string, patterns []string) bool {
+	if host == "" {
+		return false
+	}
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		switch {
+		case p == "*":
+			return true
+		case strings.HasPrefix(p, "*."):
+			if strings.HasSuffix(host, p[1:]) {
+				return true
+			}
+		case strings.HasPrefix(p, "."):
+			if host == p[1:] || strings.HasSuffix(host, p) {
+				return true
+			}
+		case host == p:
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NoCacheHandler marks responses as non-cacheable by browsers and proxies,
+// for pages that show account or financial data.
+func NoCacheHandler(h http.Handler) http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+		w.Header().Set("Pragma", "no-cache")
+		w.Header().Set("Expires", "0")
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(f)
+}
+
+// ShortCircuitHandler returns middleware that answers requests for which stop
+// returns true with respond, without calling the rest of the chain. It is the
+// building block for filters such as maintenance mode or host checks:
+//
+//	blockBots := goweb.ShortCircuitHandler(
+//		func(r *http.Request) bool { return strings.Contains(r.UserAgent(), "BadBot") },
+//		func(w http.ResponseWriter, r *http.Request) {
+//			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+//		},
+//	)
+func ShortCircuitHandler(stop func(r *http.Request) bool, respond http.HandlerFunc) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			if stop(r) {
+				respond(w, r)
+				return
+			}
+			h.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(f)
+	}
+}
+
+// FinalizerHandler returns middleware that calls fn once the response is
+// complete, with its final status, for work that must always happen such as
+// ending a trace span or closing a request-scoped transaction. fn also runs
+// when the handler panics: placed before RecoverHandler it sees the 500 that
+// RecoverHandler sent, placed after it fn is called with the status
+// RecoverHandler is about to send and the panic continues on to it. A panic
+// after the response started reports the status the client already got.
+func FinalizerHandler(fn func(r *http.Request, status int)) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			rec := newStatusRecorder(w)
+			defer func() {
+				if p := recover(); p != nil {
+					status := http.StatusInternalServerError
+					if rec.headerWritten() {
+						status = rec.statusCode()
+					} else if s, ok := panicStatus(p); ok {
+						status = s
+					}
+					fn(r, status)
+					panic(p)
+				}
+				fn(r, rec.statusCode())
+			}()
+			h.ServeHTTP(rec, r)
+		}
+		return http.HandlerFunc(f)
+	}
+}
@@ -0,0 +1,169 @@
+package goweb
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string { return "not found" }
+
+func TestFinalizerHandlerStatus(t *testing.T) {
+	RegisterPanicStatus(notFoundError{}, http.StatusNotFound)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    int
+	}{
+		{"ok", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) }, http.StatusCreated},
+		{"panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") }, http.StatusInternalServerError},
+		{"mapped panic", func(w http.ResponseWriter, r *http.Request) { panic(notFoundError{}) }, http.StatusNotFound},
+		{"panic after writing", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("partial"))
+			panic(notFoundError{})
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got int
+			h := RecoverHandler(FinalizerHandler(func(r *http.Request, status int) { got = status })(tt.handler))
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			if got != tt.want {
+				t.Errorf("finalizer got status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalHostHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		tls     bool
+		proto   string
+		proxies int
+		want    string
+	}{
+		{"http default port", "Example.COM:80", false, "", 0, "example.com"},
+		{"https default port", "example.com:443", true, "", 0, "example.com"},
+		{"http on 443", "example.com:443", false, "", 0, "example.com:443"},
+		{"https on 80", "example.com:80", true, "", 0, "example.com:80"},
+		{"other port", "example.com:8080", false, "", 0, "example.com:8080"},
+		{"ipv6", "[::1]:80", false, "", 0, "[::1]"},
+		{"forwarded https", "example.com:443", false, "https", 1, "example.com"},
+		{"untrusted forwarded https", "example.com:443", false, "https", 0, "example.com:443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSettings(t, Config{TrustedProxyCount: tt.proxies})
+			var got string
+			h := CanonicalHostHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Host
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = tt.host
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("Host = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedHostsHandler(t *testing.T) {
+	router := NewRouter()
+	router.GET("/", reply("home"))
+	router.GET("/healthz", reply("ok"))
+	h := handler(Config{
+		Router:           router,
+		AllowedHosts:     []string{"example.com", "*.example.com"},
+		HealthCheckPaths: []string{"/healthz"},
+	})
+
+	tests := []struct {
+		name, host, path string
+		want             int
+	}{
+		{"allowed", "example.com", "/", http.StatusOK},
+		{"wildcard subdomain", "app.example.com:8080", "/", http.StatusOK},
+		{"forged host", "evil.test", "/", http.StatusBadRequest},
+		{"lookalike", "example.com.evil.test", "/", http.StatusBadRequest},
+		{"health check", "10.0.0.7:8080", "/healthz", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Host = tt.host
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortCircuitHandler(t *testing.T) {
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	reached := false
+	block := ShortCircuitHandler(
+		func(r *http.Request) bool { return strings.Contains(r.UserAgent(), "BadBot") },
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		},
+	)
+	h := RequestMetricsHandler(block(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	})))
+
+	w := serve(h, http.MethodGet, "/bot", http.Header{"User-Agent": {"BadBot/1.0"}})
+	if w.Code != http.StatusForbidden || reached {
+		t.Errorf("status = %d, handler reached = %v; want 403 and not reached", w.Code, reached)
+	}
+	if !strings.Contains(logged.String(), "Request: /bot GET 403") {
+		t.Errorf("short-circuited request not logged with its status:\n%s", logged.String())
+	}
+
+	serve(h, http.MethodGet, "/", http.Header{"User-Agent": {"Mozilla/5.0"}})
+	if !reached {
+		t.Error("request that passed the filter did not reach the handler")
+	}
+}
+
+func TestShortCircuitBeforeRouting(t *testing.T) {
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	SetMaintenance(true)
+	defer SetMaintenance(false)
+
+	reached := false
+	router := NewRouter()
+	router.GET("/", func(w http.ResponseWriter, r *http.Request) { reached = true })
+	h := handler(Config{Router: router})
+
+	w := serve(h, http.MethodGet, "/", nil)
+	if w.Code != http.StatusServiceUnavailable || reached {
+		t.Errorf("status = %d, route reached = %v; want 503 and not reached", w.Code, reached)
+	}
+	if !strings.Contains(logged.String(), "Request: / GET 503") {
+		t.Errorf("maintenance response not logged with its status:\n%s", logged.String())
+	}
+}
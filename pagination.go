@@ -0,0 +1,123 @@
+package goweb
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultPerPage and MaxPerPage bound the page size read by Paginate.
+var (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+)
+
+// PageInfo describes one page of a list response.
+type PageInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+
+	// Offset and Limit are the values to use in the list query.
+	Offset int `json:"-"`
+	Limit  int `json:"-"`
+
+	// Next, Prev, First and Last are URLs of the neighbouring pages, empty
+	// when there is no such page.
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	First string `json:"first,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// Paginate reads the page and per_page query params of r, falling back to
+// page 1 and DefaultPerPage and capping per_page at MaxPerPage, and works
+// out the offset, limit and page links for a list of total items. Pages so
+// large that the offset would overflow are clamped, so Offset is never
+// negative.
+func Paginate(r *http.Request, total int) PageInfo {
+	q := r.URL.Query()
+
+	perPage, err := strconv.Atoi(q.Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = DefaultPerPage
+	}
+	if perPage > MaxPerPage {
+		perPage = MaxPerPage
+	}
+
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	// keep the offset from overflowing into a negative value
+	if maxPage := math.MaxInt / perPage; page > maxPage {
+		page = maxPage
+	}
+
+	if total < 0 {
+		total = 0
+	}
+	totalPages := total / perPage
+	if total%perPage != 0 {
+		totalPages++
+	}
+
+	p := PageInfo{
+		Page:       page,
+		PerPage:    perPage,
+		Total:      total,
+		TotalPages: totalPages,
+		Offset:     (page - 1) * perPage,
+		Limit:      perPage,
+	}
+
+	link := func(n int) string {
+		v := r.URL.Query()
+		v.Set("page", strconv.Itoa(n))
+		v.Set("per_page", strconv.Itoa(perPage))
+		return r.URL.EscapedPath() + "?" + v.Encode()
+	}
+	if totalPages > 0 {
+		p.First = link(1)
+		p.Last = link(totalPages)
+	}
+	if page < totalPages {
+		p.Next = link(page + 1)
+	}
+	if page > 1 && totalPages > 0 {
+		p.Prev = link(min(page-1, totalPages))
+	}
+	return p
+}
+
+// LinkHeader returns the page links formatted as an RFC 8288 Link header.
+func (p PageInfo) LinkHeader() string {
+	var links []string
+	for _, l := range []struct{ rel, url string }{
+		{"next", p.Next},
+		{"prev", p.Prev},
+		{"first", p.First},
+		{"last", p.Last},
+	} {
+		if l.url != "" {
+			links = append(links, fmt.Sprintf("<%s>; rel=%q", l.url, l.rel))
+		}
+	}
+	return strings.Join(links, ", ")
+}
+
+// JSONList writes data as a paginated JSON list of the form
+// {"data": [...], "meta": {...}} and sets the Link header from p.
+func JSONList(w http.ResponseWriter, status int, data interface{}, p PageInfo) error {
+	if link := p.LinkHeader(); link != "" {
+		w.Header().Set("Link", link)
+	}
+	return JSON(w, status, map[string]interface{}{
+		"data": data,
+		"meta": p,
+	})
+}
@@ -0,0 +1,49 @@
+package goweb
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		query          string
+		total          int
+		page, perPage  int
+		offset, pages  int
+		wantNext, prev bool
+	}{
+		{"", 45, 1, 20, 0, 3, true, false},
+		{"page=2&per_page=10", 45, 2, 10, 10, 5, true, true},
+		{"page=3", 45, 3, 20, 40, 3, false, true},
+		{"page=0&per_page=-5", 45, 1, 20, 0, 3, true, false},
+		{"per_page=1000", 45, 1, 100, 0, 1, false, false},
+		{"page=abc", 0, 1, 20, 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			p := Paginate(httptest.NewRequest(http.MethodGet, "/items?"+tt.query, nil), tt.total)
+			if p.Page != tt.page || p.PerPage != tt.perPage || p.Offset != tt.offset || p.TotalPages != tt.pages {
+				t.Errorf("got page %d per_page %d offset %d pages %d", p.Page, p.PerPage, p.Offset, p.TotalPages)
+			}
+			if (p.Next != "") != tt.wantNext || (p.Prev != "") != tt.prev {
+				t.Errorf("got next %q prev %q", p.Next, p.Prev)
+			}
+		})
+	}
+}
+
+func TestPaginateHugePage(t *testing.T) {
+	for _, page := range []string{strconv.Itoa(math.MaxInt), "9223372036854775807", "4611686018427387904"} {
+		p := Paginate(httptest.NewRequest(http.MethodGet, "/items?per_page=100&page="+page, nil), 10)
+		if p.Offset < 0 {
+			t.Errorf("page %s: Offset = %d", page, p.Offset)
+		}
+		if p.Offset > math.MaxInt-p.PerPage {
+			t.Errorf("page %s: Offset %d leaves no room for Limit", page, p.Offset)
+		}
+	}
+}
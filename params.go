@@ -0,0 +1,88 @@
+package goweb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrMissingParam is wrapped by the ParamError returned for absent params.
+var ErrMissingParam = errors.New("goweb: missing param")
+
+// ParamError reports a path param that is missing or malformed. Handlers can
+// answer it with a 400.
+type ParamError struct {
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *ParamError) Error() string {
+	if errors.Is(e.Err, ErrMissingParam) {
+		return fmt.Sprintf("goweb: missing param %q", e.Name)
+	}
+	return fmt.Sprintf("goweb: invalid param %q value %q: %v", e.Name, e.Value, e.Err)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// ParamInt returns the path param name as an int.
+func ParamInt(r *http.Request, name string) (int, error) {
+	v, err := ParamInt64(r, name)
+	if err != nil {
+		return 0, err
+	}
+	if int64(int(v)) != v {
+		return 0, &ParamError{Name: name, Value: Param(r, name), Err: strconv.ErrRange}
+	}
+	return int(v), nil
+}
+
+// ParamInt64 returns the path param name as an int64.
+func ParamInt64(r *http.Request, name string) (int64, error) {
+	s := Param(r, name)
+	if s == "" {
+		return 0, &ParamError{Name: name, Err: ErrMissingParam}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, &ParamError{Name: name, Value: s, Err: errors.Unwrap(err)}
+	}
+	return v, nil
+}
+
+// ParamUUID returns the path param name, lowercased, after checking it is a
+// UUID in its canonical 8-4-4-4-12 hex form.
+func ParamUUID(r *http.Request, name string) (string, error) {
+	s := Param(r, name)
+	if s == "" {
+		return "", &ParamError{Name: name, Err: ErrMissingParam}
+	}
+	if !isUUID(s) {
+		return "", &ParamError{Name: name, Value: s, Err: errors.New("not a UUID")}
+	}
+	return strings.ToLower(s), nil
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package goweb
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// withParam returns a request whose "id" path param is value, or one with no
+// params when value is empty.
+func withParam(value string) *http.Request {
+	r := httptest.NewRequest("GET", "/users/x", nil)
+	if value == "" {
+		return r
+	}
+	return withRoute(r, "/users/:id", map[string]string{"id": value})
+}
+
+func TestParamInt(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		err   error
+	}{
+		{"42", 42, nil},
+		{"-7", -7, nil},
+		{"9223372036854775807", 1<<63 - 1, nil},
+		{"9223372036854775808", 0, strconv.ErrRange},
+		{"-9223372036854775809", 0, strconv.ErrRange},
+		{"12abc", 0, strconv.ErrSyntax},
+		{"1.5", 0, strconv.ErrSyntax},
+		{" 1", 0, strconv.ErrSyntax},
+		{"", 0, ErrMissingParam},
+	}
+	for _, tt := range tests {
+		r := withParam(tt.value)
+
+		got64, err := ParamInt64(r, "id")
+		if got64 != tt.want || !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+			t.Errorf("ParamInt64(%q) = %d, %v; want %d, %v", tt.value, got64, err, tt.want, tt.err)
+		}
+
+		// On 64-bit platforms int holds every int64; elsewhere the larger
+		// values must be rejected as out of range rather than truncated.
+		want, wantErr := int(tt.want), tt.err
+		if int64(want) != tt.want {
+			want, wantErr = 0, strconv.ErrRange
+		}
+		got, err := ParamInt(r, "id")
+		if got != want || !errors.Is(err, wantErr) || (wantErr == nil) != (err == nil) {
+			t.Errorf("ParamInt(%q) = %d, %v; want %d, %v", tt.value, got, err, want, wantErr)
+		}
+	}
+}
+
+func TestParamUUID(t *testing.T) {
+	tests := []struct {
+		value, want string
+		err         bool
+	}{
+		{"3f2504e0-4f89-11d3-9a0c-0305e82c3301", "3f2504e0-4f89-11d3-9a0c-0305e82c3301", false},
+		{"3F2504E0-4F89-11D3-9A0C-0305E82C3301", "3f2504e0-4f89-11d3-9a0c-0305e82c3301", false},
+		{"3f2504e04f8911d39a0c0305e82c3301", "", true},
+		{"{3f2504e0-4f89-11d3-9a0c-0305e82c3301}", "", true},
+		{"3f2504e0-4f89-11d3-9a0c-0305e82c330", "", true},
+		{"3f2504e0_4f89_11d3_9a0c_0305e82c3301", "", true},
+		{"3g2504e0-4f89-11d3-9a0c-0305e82c3301", "", true},
+		{"3f2504e0-4f89-11d3-9a0c-0305e82c33é", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParamUUID(withParam(tt.value), "id")
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("ParamUUID(%q) = %q, %v; want %q", tt.value, got, err, tt.want)
+		}
+		var perr *ParamError
+		if tt.err && (!errors.As(err, &perr) || perr.Name != "id" || perr.Value != tt.value) {
+			t.Errorf("ParamUUID(%q) error = %#v, want a ParamError for id", tt.value, err)
+		}
+	}
+
+	if _, err := ParamUUID(withParam(""), "id"); !errors.Is(err, ErrMissingParam) {
+		t.Errorf("ParamUUID of a missing param: error = %v, want ErrMissingParam", err)
+	}
+}
+
+func TestParamErrorMessages(t *testing.T) {
+	_, err := ParamInt(withParam(""), "id")
+	if got, want := err.Error(), `goweb: missing param "id"`; got != want {
+		t.Errorf("missing: %q, want %q", got, want)
+	}
+	_, err = ParamInt(withParam("x"), "id")
+	if got, want := err.Error(), `goweb: invalid param "id" value "x": invalid syntax`; got != want {
+		t.Errorf("invalid: %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package goweb
+
+import "strings"
+
+// Path patterns are matched one "/"-separated segment at a time. A segment
+// is static and must match exactly, a :name param matching any one non-empty
+// segment, or, as the last segment, a *name catch-all matching the rest of
+// the path. A pattern ending in "/" is a subtree matching every path below
+// it, as with http.ServeMux. Param values are read with Param.
+
+// Segment kinds, in order of precedence.
+const (
+	staticSegment = iota
+	paramSegment
+	catchAllSegment
+)
+
+func segmentKind(segments []string, i int) int {
+	seg := segments[i]
+	switch {
+	case strings.HasPrefix(seg, ":"):
+		return paramSegment
+	case strings.HasPrefix(seg, "*"), seg == "" && i == len(segments)-1:
+		return catchAllSegment
+	}
+	return staticSegment
+}
+
+// precedes reports whether ep should be tried before other. Patterns are
+// compared segment by segment: at the first segment where they differ in
+// kind, a static segment beats a :param, which beats a *catch-all or
+// subtree. So /users/new wins over /users/:id, which wins over /users/, and
+// the longer static prefix wins between catch-alls. Patterns alike in kind
+// are ordered longest first, then alphabetically, so matching never depends
+// on registration order.
+func (ep *endpoint) precedes(other *endpoint) bool {
+	a, b := ep.segments, other.segments
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if ka, kb := segmentKind(a, i), segmentKind(b, i); ka != kb {
+			return ka < kb
+		}
+	}
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return ep.path < other.path
+}
+
+// equivalent reports whether ep and other match the same paths: they differ
+// at most in the names of their params and catch-alls. Neither could ever be
+// preferred over the other, so only one of them would be reachable.
+func (ep *endpoint) equivalent(other *endpoint) bool {
+	a, b := ep.segments, other.segments
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		ka, kb := segmentKind(a, i), segmentKind(b, i)
+		if ka != kb || (ka == staticSegment && a[i] != b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// static reports whether the pattern matches only itself.
+func (ep *endpoint) static() bool {
+	return !ep.subtree() && !strings.ContainsAny(ep.path, ":*")
+}
+
+// subtree reports whether the pattern matches every path below it.
+func (ep *endpoint) subtree() bool {
+	return strings.HasSuffix(ep.path, "/")
+}
+
+// match reports whether path matches the pattern and returns the values of
+// its params.
+func (ep *endpoint) match(path string) (map[string]string, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	var params map[string]string
+
+	for i, seg := range ep.segments {
+		last := i == len(ep.segments)-1
+		switch {
+		case last && seg == "":
+			// subtree pattern: anything below the prefix matches
+			return params, len(parts) > i
+		case last && strings.HasPrefix(seg, "*"):
+			if len(parts) < i {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:]] = strings.Join(parts[i:], "/")
+			return params, true
+		case i >= len(parts):
+			return nil, false
+		case strings.HasPrefix(seg, ":"):
+			if parts[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:]] = parts[i]
+		case seg != parts[i]:
+			return nil, false
+		}
+	}
+	return params, len(parts) == len(ep.segments)
+}
@@ -0,0 +1,80 @@
+package goweb
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestEndpointMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		ok            bool
+		params        map[string]string
+	}{
+		{"/users", "/users", true, nil},
+		{"/users", "/users/1", false, nil},
+		{"/users/:id", "/users/42", true, map[string]string{"id": "42"}},
+		{"/users/:id", "/users/", false, nil},
+		{"/users/:id/posts/:post", "/users/1/posts/2", true, map[string]string{"id": "1", "post": "2"}},
+		{"/files/*path", "/files/a/b.txt", true, map[string]string{"path": "a/b.txt"}},
+		{"/files/*path", "/files/", true, map[string]string{"path": ""}},
+		{"/docs/", "/docs/guide/intro", true, nil},
+		{"/docs/", "/docs", false, nil},
+	}
+	for _, tt := range tests {
+		params, ok := newEndpoint(tt.pattern).match(tt.path)
+		if ok != tt.ok || (ok && !reflect.DeepEqual(params, tt.params)) {
+			t.Errorf("%s matching %s = %v %v, want %v %v", tt.pattern, tt.path, params, ok, tt.params, tt.ok)
+		}
+	}
+}
+
+func TestParamAndRoutePattern(t *testing.T) {
+	var id, pattern string
+	router := NewRouter()
+	router.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		id, pattern = Param(r, "id"), RoutePattern(r)
+	})
+
+	serve(router, http.MethodGet, "/users/42", nil)
+	if id != "42" || pattern != "/users/:id" {
+		t.Errorf("Param = %q, RoutePattern = %q", id, pattern)
+	}
+}
+
+func TestRoutePrecedence(t *testing.T) {
+	patterns := []string{"/", "/users/", "/users/:id", "/users/new", "/users/:id/posts", "/users/new/*rest", "/files/*path", "/files/public/*path"}
+	tests := []struct{ path, want string }{
+		{"/users/new", "/users/new"},
+		{"/users/42", "/users/:id"},
+		{"/users/42/posts", "/users/:id/posts"},
+		{"/users/42/friends", "/users/"},
+		{"/users/new/draft", "/users/new/*rest"},
+		{"/files/public/logo.png", "/files/public/*path"},
+		{"/files/private/key.pem", "/files/*path"},
+		{"/about", "/"},
+	}
+
+	// the outcome must not depend on the order routes are registered in
+	orders := [][]string{patterns, reversed(patterns)}
+	for _, order := range orders {
+		router := NewRouter()
+		for _, p := range order {
+			router.GET(p, reply(p))
+		}
+		for _, tt := range tests {
+			if got := serve(router, http.MethodGet, tt.path, nil).Body.String(); got != tt.want {
+				t.Errorf("registered %v: %s routed to %s, want %s", order, tt.path, got, tt.want)
+			}
+		}
+	}
+}
+
+func reversed(s []string) []string {
+	r := make([]string, len(s))
+	for i, v := range s {
+		r[len(s)-1-i] = v
+	}
+	return r
+}
@@ -1,46 +1,407 @@
 package goweb
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"mime"
 	"net/http"
+	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
+	texttemplate "text/template"
+	"time"
 
 	logger "github.com/phil-inc/plog-ng/pkg/core"
+	"golang.org/x/text/language"
 )
 
 // Render reads a template files, applies data, and writes the output to an http.ResponseWriter.
 func Render(r *http.Request, w http.ResponseWriter, templateFiles []string, data map[string]interface{}) {
-	w.Header().Set("Content-Type", "text/html")
+	layoutFiles := []string{"index.html", "navbar.html"}
+	layoutFiles = append(layoutFiles, templateFiles...)
 
-	// nil is passed from handlers that do not need to pass data to the template
-	if data == nil {
-		data = make(map[string]interface{})
+	render(r, w, "text/html; charset=utf-8", false, layoutFiles, data)
+}
+
+// RenderWithContentType renders templateFiles like Render but sends them with
+// contentType, e.g. for SVG images or plain text. The layout files are not
+// added, so the first template is the one executed. Output is escaped by
+// html/template, since browsers run scripts in SVG and other XML served from
+// the app's origin, except for plain text types such as text/plain and
+// text/csv, which are rendered unescaped. An empty contentType means HTML.
+// XML documents, whose prolog html/template escapes, are rendered with
+// RenderText.
+func RenderWithContentType(r *http.Request, w http.ResponseWriter, contentType string, templateFiles []string, data map[string]interface{}) {
+	if contentType == "" {
+		contentType = "text/html; charset=utf-8"
 	}
+	render(r, w, contentType, isPlainTextContentType(contentType), templateFiles, data)
+}
 
-	layoutFiles := []string{"index.html", "navbar.html"}
-	layoutFiles = append(layoutFiles, templateFiles...)
+// RenderText is RenderWithContentType with text/template: nothing is
+// escaped, neither the template nor data, which the template must escape
+// itself where needed, e.g. {{ .Title | html }} in an XML feed. Never use it
+// to put user data into HTML or SVG.
+func RenderText(r *http.Request, w http.ResponseWriter, contentType string, templateFiles []string, data map[string]interface{}) {
+	render(r, w, contentType, true, templateFiles, data)
+}
+
+// plainTextContentTypes are the content types browsers never interpret as
+// markup, so their output needs no escaping.
+var plainTextContentTypes = map[string]bool{
+	"text/plain":    true,
+	"text/csv":      true,
+	"text/calendar": true,
+	"text/markdown": true,
+}
+
+// isPlainTextContentType reports whether output of contentType is plain text
+// and so is rendered without html/template's escaping.
+func isPlainTextContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && plainTextContentTypes[mediaType]
+}
+
+// render executes layoutFiles within the request's render budget and writes
+// the output to w with contentType, unescaped if text is set.
+func render(r *http.Request, w http.ResponseWriter, contentType string, text bool, layoutFiles []string, data map[string]interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	s := settingsFor(r)
+
+	// copy data so adding the request values does not modify the caller's
+	// map; nil is passed from handlers that do not need to pass data
+	merged := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		merged[k] = v
+	}
+	if _, ok := merged["ctx"]; !ok {
+		merged["ctx"] = contextValues(r)
+	}
+	data = merged
+
+	if s.devMode {
+		if err := reloadPartialsIfChanged(); err != nil {
+			logErrorAndRespond(w, "error reloading partials", err)
+			return
+		}
+	}
+
+	ctx, cancel := renderContext(r)
+	defer cancel()
 
 	// Render nested templates
-	if err := renderTemplates(w, data, layoutFiles...); err != nil {
+	start := time.Now()
+	buf, err := renderWithContext(ctx, text, s.strictTemplateVars, requestFuncs(r), data, layoutFiles...)
+	if elapsed := time.Since(start); s.slowRenderThreshold > 0 && elapsed > s.slowRenderThreshold {
+		logger.Warnf("slow render of %s took %s: %v", r.RequestURI, elapsed, layoutFiles)
+	}
+
+	// the client may have gone away while the template was executing
+	if ctxErr := r.Context().Err(); ctxErr != nil {
+		logger.Debugf("abandoning render of %s: %v", r.RequestURI, ctxErr)
+		return
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.Errorf("render of %s exceeded its budget: %v", r.RequestURI, layoutFiles)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
 		logErrorAndRespond(w, "error executing template", err)
+		return
+	}
+
+	if _, err := buf.WriteTo(w); err != nil {
+		logger.Debugf("error writing rendered template for %s: %v", r.RequestURI, err)
+	}
+}
+
+// RenderTo executes templateFiles with data and writes the output to wr. It is
+// the building block for rendering outside of a response, and unlike Render
+// it does not add the layout files. Partials registered with RegisterPartials
+// are available.
+func RenderTo(wr io.Writer, templateFiles []string, data map[string]interface{}) error {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	return renderTemplates(wr, false, defaultSettings.Load().strictTemplateVars, nil, data, templateFiles...)
+}
+
+// RenderString executes templateFiles with data and returns the output, e.g.
+// to reuse view templates for email bodies.
+func RenderString(templateFiles []string, data map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := RenderTo(&buf, templateFiles, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// renderDeadlineMargin is reserved from the request deadline so a render that
+// runs out of budget can still send its own error response.
+const renderDeadlineMargin = 250 * time.Millisecond
+
+// renderContext returns the context bounding template execution for r. When
+// the request has a deadline, such as one set by TimeoutHandler, the render
+// must finish a little before it; otherwise it gets the handler timeout.
+func renderContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := r.Context()
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(ctx, deadline.Add(-renderDeadlineMargin))
+	}
+	return context.WithTimeout(ctx, handlerTimeout)
+}
+
+// renderWithContext executes templates into a buffer, giving up when ctx is
+// done. Templates cannot be interrupted, so execution runs in its own
+// goroutine and an abandoned render is left to finish into its buffer.
+func renderWithContext(ctx context.Context, text, strict bool, funcs template.FuncMap, data map[string]interface{}, files ...string) (*bytes.Buffer, error) {
+	type result struct {
+		buf   *bytes.Buffer
+		err   error
+		panic interface{}
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		defer func() {
+			res.panic = recover()
+			done <- res
+		}()
+		res.buf = new(bytes.Buffer)
+		res.err = renderTemplates(res.buf, text, strict, funcs, data, files...)
+	}()
+
+	select {
+	case res := <-done:
+		if res.panic != nil {
+			// re-panic on the request goroutine so RecoverHandler sees it
+			panic(res.panic)
+		}
+		return res.buf, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
-// renderTemplates executes templates and writes the output to an http.ResponseWriter.
-func renderTemplates(w http.ResponseWriter, data map[string]interface{}, files ...string) error {
-	tmpl := parseTemplates(files...)
+// renderTemplates executes templates and writes the output to w, as text
+// rather than HTML when text is set. When strict is set, reading a key
+// missing from data is an error. funcs, when not nil, replaces
+// request-specific helpers such as the locale formatters.
+func renderTemplates(w io.Writer, text, strict bool, funcs template.FuncMap, data map[string]interface{}, files ...string) error {
+	if text {
+		tmpl, err := parseTextTemplates(files...)
+		if err != nil {
+			return err
+		}
+		if funcs != nil {
+			tmpl.Funcs(texttemplate.FuncMap(funcs))
+		}
+		if strict {
+			tmpl.Option("missingkey=error")
+		}
+		return tmpl.Execute(w, data)
+	}
+
+	tmpl, err := parseTemplates(files...)
+	if err != nil {
+		return err
+	}
+	if funcs != nil {
+		tmpl.Funcs(funcs)
+	}
+	if strict {
+		tmpl.Option("missingkey=error")
+	}
 	return tmpl.Execute(w, data)
 }
 
+// requestFuncs returns the template helpers that depend on r: the locale
+// formatters, and assetPath and urlFor for the server serving r.
+func requestFuncs(r *http.Request) template.FuncMap {
+	funcs := localeFuncs(Locale(r))
+	s := settingsFor(r)
+	funcs["assetPath"] = func(file string) (string, error) {
+		return assetPathUnder(s.assetsRoot, file), nil
+	}
+	funcs["urlFor"] = s.router.urlFor
+	return funcs
+}
+
+// partials holds the templates registered with RegisterPartials. Every
+// template set built by parseTemplates starts as a clone of it. Changes build
+// a new set and swap the pointer, so renders never wait for a reload and
+// never see a half-parsed set; mu only serializes the writers. The locale
+// formatters default to English until Render binds the request's locale.
+var partials struct {
+	mu  sync.Mutex
+	set atomic.Pointer[partialSet]
+}
+
+// partialSet is the parsed partials with the files they came from and the
+// modification times those files had when they were read.
+type partialSet struct {
+	tmpl     *template.Template
+	files    []string
+	modTimes []time.Time
+}
+
+func init() {
+	partials.set.Store(&partialSet{tmpl: newPartials()})
+}
+
+func newPartials() *template.Template {
+	return template.New("partials").Funcs(helperFuncs).Funcs(localeFuncs(language.English))
+}
+
+// partialModTimes returns the modification times of the partial files, zero
+// for files that cannot be read.
+func partialModTimes(files []string) []time.Time {
+	times := make([]time.Time, len(files))
+	for i, path := range templatePaths(files...) {
+		if fi, err := os.Stat(path); err == nil {
+			times[i] = fi.ModTime()
+		}
+	}
+	return times
+}
+
+// changed reports whether any of the set's files changed since it was parsed.
+func (ps *partialSet) changed() bool {
+	for i, t := range partialModTimes(ps.files) {
+		if !t.Equal(ps.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterPartials parses template files once and makes the templates they
+// define available to every Render call, so shared components such as a
+// header or button can be invoked with {{ template "button" . }} without
+// listing their files in each handler. Paths are relative to the templates
+// directory, like those passed to Render.
+func RegisterPartials(files ...string) error {
+	partials.mu.Lock()
+	defer partials.mu.Unlock()
+
+	cur := partials.set.Load()
+	// stat before parsing, so a change made while parsing is seen next time
+	modTimes := partialModTimes(files)
+	tmpl, err := cur.tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	if _, err := tmpl.ParseFiles(templatePaths(files...)...); err != nil {
+		return err
+	}
+	partials.set.Store(&partialSet{
+		tmpl:     tmpl,
+		files:    append(append([]string{}, cur.files...), files...),
+		modTimes: append(append([]time.Time{}, cur.modTimes...), modTimes...),
+	})
+	return nil
+}
+
+// ReloadPartials parses the files registered with RegisterPartials again,
+// picking up changes made since. On error the previous partials stay in use.
+// In dev mode Render reloads them whenever one of the files has changed.
+func ReloadPartials() error {
+	partials.mu.Lock()
+	defer partials.mu.Unlock()
+	return reloadPartials(partials.set.Load())
+}
+
+// reloadPartialsIfChanged reloads the partials when one of their files
+// changed on disk. Checking only stats the files, so concurrent renders do
+// not queue up behind each other re-reading unchanged files.
+func reloadPartialsIfChanged() error {
+	if !partials.set.Load().changed() {
+		return nil
+	}
+	partials.mu.Lock()
+	defer partials.mu.Unlock()
+
+	// another render may have reloaded them while we waited
+	cur := partials.set.Load()
+	if !cur.changed() {
+		return nil
+	}
+	return reloadPartials(cur)
+}
+
+// reloadPartials parses the files of cur into a new set. partials.mu must be
+// held.
+func reloadPartials(cur *partialSet) error {
+	modTimes := partialModTimes(cur.files)
+	tmpl := newPartials()
+	if len(cur.files) > 0 {
+		if _, err := tmpl.ParseFiles(templatePaths(cur.files...)...); err != nil {
+			return err
+		}
+	}
+	partials.set.Store(&partialSet{tmpl: tmpl, files: cur.files, modTimes: modTimes})
+	return nil
+}
+
 // parseTemplates parses files, adds functions to the template, and returns a template.
-func parseTemplates(files ...string) *template.Template {
+func parseTemplates(files ...string) (*template.Template, error) {
+	if len(files) == 0 {
+		return nil, errors.New("goweb: no template files given")
+	}
+	paths := templatePaths(files...)
+
+	tmpl, err := partials.set.Load().tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tmpl.ParseFiles(paths...); err != nil {
+		return nil, err
+	}
+	return tmpl.Lookup(filepath.Base(paths[0])), nil
+}
+
+// parseTextTemplates is parseTemplates for output that is not HTML. The
+// partial files are parsed along with files so their templates can still be
+// invoked, but as text.
+func parseTextTemplates(files ...string) (*texttemplate.Template, error) {
+	if len(files) == 0 {
+		return nil, errors.New("goweb: no template files given")
+	}
+	paths := templatePaths(files...)
+
+	partialPaths := templatePaths(partials.set.Load().files...)
+
+	tmpl := texttemplate.New("partials").
+		Funcs(texttemplate.FuncMap(helperFuncs)).
+		Funcs(texttemplate.FuncMap(localeFuncs(language.English)))
+	if len(partialPaths) > 0 {
+		if _, err := tmpl.ParseFiles(partialPaths...); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tmpl.ParseFiles(paths...); err != nil {
+		return nil, err
+	}
+	return tmpl.Lookup(filepath.Base(paths[0])), nil
+}
+
+// templatePaths resolves template file names against the templates directory.
+func templatePaths(files ...string) []string {
 	viewsDirPath := fmt.Sprintf("%s/templates", DirectoryPath())
 	paths := make([]string, len(files))
 	for i, file := range files {
 		paths[i] = filepath.Join(viewsDirPath, file)
 	}
-	return template.Must(template.ParseFiles(paths...))
+	return paths
 }
 
 func logErrorAndRespond(w http.ResponseWriter, message string, err error) {
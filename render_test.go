@@ -0,0 +1,165 @@
+package goweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRenderContentTypeCharset(t *testing.T) {
+	withTemplates(t, map[string]string{
+		"index.html":  `<html>{{template "navbar.html" .}}{{template "content" .}}</html>`,
+		"navbar.html": `<nav></nav>`,
+		"page.html":   `{{define "content"}}<p>{{.greeting}}</p>{{end}}`,
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	Render(r, w, []string{"page.html"}, map[string]interface{}{"greeting": "Grüße 👋"})
+
+	if got := w.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/html; charset=utf-8", got)
+	}
+	if got := w.Body.String(); got != "<html><nav></nav><p>Grüße 👋</p></html>" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestRenderTextXML(t *testing.T) {
+	withTemplates(t, map[string]string{
+		"feed.xml": `<?xml version="1.0" encoding="UTF-8"?><feed><title>{{.title | html}}</title></feed>`,
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/feed.xml", nil)
+	RenderText(r, w, "application/atom+xml; charset=utf-8", []string{"feed.xml"}, map[string]interface{}{"title": "News & <b>"})
+
+	if got := w.Header().Get("Content-Type"); got != "application/atom+xml; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?><feed><title>News &amp; &lt;b&gt;</title></feed>`
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestRenderWithContentTypeSVGEscapes(t *testing.T) {
+	withTemplates(t, map[string]string{"badge.svg": `<svg><text>{{.name}}</text></svg>`})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/badge.svg", nil)
+	RenderWithContentType(r, w, "image/svg+xml", []string{"badge.svg"}, map[string]interface{}{"name": "<script>alert(1)</script>"})
+
+	if got := w.Body.String(); got != "<svg><text>&lt;script&gt;alert(1)&lt;/script&gt;</text></svg>" {
+		t.Errorf("user data not escaped in SVG: %q", got)
+	}
+}
+
+func TestRenderWithContentTypePlainText(t *testing.T) {
+	withTemplates(t, map[string]string{"robots.txt": `Disallow: {{.path}} & more`})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+	RenderWithContentType(r, w, "text/plain; charset=utf-8", []string{"robots.txt"}, map[string]interface{}{"path": "/a&b"})
+
+	if got := w.Body.String(); got != "Disallow: /a&b & more" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestRenderWithContentTypeDefaultsToHTML(t *testing.T) {
+	withTemplates(t, map[string]string{"page.html": `<p>{{.name}}</p>`})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	RenderWithContentType(r, w, "", []string{"page.html"}, map[string]interface{}{"name": "<b>"})
+
+	if got := w.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := w.Body.String(); got != "<p>&lt;b&gt;</p>" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestDevModeReloadsChangedPartials(t *testing.T) {
+	withTemplates(t, map[string]string{
+		"button.html": `{{define "button"}}old{{end}}`,
+		"page.html":   `{{template "button"}}`,
+	})
+	resetPartials(t)
+	withSettings(t, Config{DevMode: true})
+
+	if err := RegisterPartials("button.html"); err != nil {
+		t.Fatal(err)
+	}
+	render := func() string {
+		w := httptest.NewRecorder()
+		RenderWithContentType(httptest.NewRequest(http.MethodGet, "/", nil), w, "", []string{"page.html"}, nil)
+		return w.Body.String()
+	}
+
+	loaded := partials.set.Load()
+	if got := render(); got != "old" {
+		t.Fatalf("body = %q", got)
+	}
+	if partials.set.Load() != loaded {
+		t.Error("unchanged partials were reloaded")
+	}
+
+	path := filepath.Join("views", "templates", "button.html")
+	if err := os.WriteFile(path, []byte(`{{define "button"}}new{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != "new" {
+		t.Errorf("body after change = %q", got)
+	}
+}
+
+// TestConcurrentReloadAndRender is meant to be run with -race.
+func TestConcurrentReloadAndRender(t *testing.T) {
+	withTemplates(t, map[string]string{
+		"button.html": `{{define "button"}}B{{end}}`,
+		"page.html":   `{{template "button"}} {{.name}}`,
+	})
+	resetPartials(t)
+	withSettings(t, Config{DevMode: true})
+
+	if err := RegisterPartials("button.html"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if err := ReloadPartials(); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if s, err := RenderString([]string{"page.html"}, map[string]interface{}{"name": "x"}); err != nil || s != "B x" {
+				t.Errorf("RenderString = %q, %v", s, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			RenderWithContentType(httptest.NewRequest(http.MethodGet, "/", nil), w, "", []string{"page.html"}, map[string]interface{}{"name": "y"})
+			if w.Body.String() != "B y" {
+				t.Errorf("Render = %d %q", w.Code, w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,532 @@
+package goweb
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justinas/alice"
+	logger "github.com/phil-inc/plog-ng/pkg/core"
+)
+
+type ControllerFunc func(w http.ResponseWriter, r *http.Request)
+
+// Router matches requests to controllers by path, method and, for versioned
+// APIs, the media type in the Accept header. Patterns may contain :name
+// segments, which match a single path segment, and a final *name segment,
+// which matches the rest of the path; both are read with Param. A pattern
+// ending in "/" matches every path below it, as with http.ServeMux.
+//
+// A request is served by the route registered for its method. When a path
+// has no route for the method, one of its other routes serves it, as routers
+// have always done; StrictMethods answers such requests with a 405 instead.
+type Router struct {
+	routerMap     map[string]*endpoint
+	order         []*endpoint
+	names         map[string]*Route
+	strictMethods bool
+}
+
+func NewRouter() *Router {
+	r := new(Router)
+	r.routerMap = make(map[string]*endpoint)
+	r.names = make(map[string]*Route)
+	return r
+}
+
+// StrictMethods makes the router answer requests for a method that has no
+// route on the path with 405 Method Not Allowed and an Allow header, instead
+// of serving them with one of the path's other routes.
+func (r *Router) StrictMethods() *Router {
+	r.strictMethods = true
+	return r
+}
+
+// GET registers controller for GET and HEAD requests to path.
+func (r *Router) GET(path string, controller ControllerFunc) *Route {
+	return r.Handle(http.MethodGet, path, controller)
+}
+
+// POST registers controller for POST requests to path.
+func (r *Router) POST(path string, controller ControllerFunc) *Route {
+	return r.Handle(http.MethodPost, path, controller)
+}
+
+// PUT registers controller for PUT requests to path.
+func (r *Router) PUT(path string, controller ControllerFunc) *Route {
+	return r.Handle(http.MethodPut, path, controller)
+}
+
+// PATCH registers controller for PATCH requests to path.
+func (r *Router) PATCH(path string, controller ControllerFunc) *Route {
+	return r.Handle(http.MethodPatch, path, controller)
+}
+
+// DELETE registers controller for DELETE requests to path.
+func (r *Router) DELETE(path string, controller ControllerFunc) *Route {
+	return r.Handle(http.MethodDelete, path, controller)
+}
+
+// Handle registers controller for requests to path with the given method.
+// Registering the same method and path again, with the same Produces media
+// type or none, shadows the earlier route: dispatch uses the route
+// registered last.
+func (r *Router) Handle(method, path string, controller ControllerFunc) *Route {
+	route := &Route{method: method, path: path, controller: controller}
+	r.add(route)
+	return route
+}
+
+// add registers route with the endpoint for its pattern.
+func (r *Router) add(route *Route) {
+	route.router = r
+	ep, ok := r.routerMap[route.path]
+	if !ok {
+		ep = newEndpoint(route.path)
+		r.routerMap[route.path] = ep
+		r.order = append(r.order, ep)
+		sort.SliceStable(r.order, func(i, j int) bool {
+			return r.order[i].precedes(r.order[j])
+		})
+	}
+	ep.routes = append(ep.routes, route)
+}
+
+// Merge mounts every route of other under prefix, so separately defined
+// routers, such as an API router and a web router, can be served together.
+// It fails without changing r if a merged route would clash with an existing
+// one: a route for the same path, method and media type, or any route whose
+// pattern matches the same paths under different param names, such as
+// /users/:uid and /users/:id, since only one of those can ever be reached.
+// other must not be used after it has been merged.
+func (r *Router) Merge(prefix string, other *Router) error {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	for name, rt := range other.names {
+		if existing, ok := r.names[name]; ok {
+			return fmt.Errorf("goweb: route name %q is used by both %s and %s", name, existing.path, prefix+rt.path)
+		}
+	}
+
+	var merged []*Route
+	for _, ep := range other.order {
+		mounted := newEndpoint(prefix + ep.path)
+		for _, existing := range r.order {
+			if !existing.equivalent(mounted) {
+				continue
+			}
+			if existing.path != mounted.path {
+				return fmt.Errorf("goweb: route %s conflicts with %s", mounted.path, existing.path)
+			}
+			for _, rt := range ep.routes {
+				for _, e := range existing.routes {
+					if e.method == rt.method && e.mediaType == rt.mediaType {
+						return fmt.Errorf("goweb: route %s %s is already registered", rt.method, mounted.path)
+					}
+				}
+			}
+		}
+		merged = append(merged, ep.routes...)
+	}
+
+	for _, rt := range merged {
+		rt.path = prefix + rt.path
+		r.add(rt)
+	}
+	for name, rt := range other.names {
+		r.names[name] = rt
+	}
+	return nil
+}
+
+// ServeHTTP dispatches the request to the route matching its path, method
+// and Accept header.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	ep, params := r.match(req.URL.Path)
+	if settingsFor(req).devMode {
+		logger.Debugf("route match for %s %s took %s", req.Method, req.URL.Path, time.Since(start))
+	}
+	if ep == nil {
+		routeError(w, req, http.StatusNotFound)
+		return
+	}
+
+	route, status := r.pick(ep, req.Method, req.Header.Get("Accept"))
+	if ep.versioned() {
+		addVary(w.Header(), "Accept")
+	}
+	if route == nil {
+		if status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", ep.allow())
+		}
+		routeError(w, req, status)
+		return
+	}
+	route.serve(w, withRoute(req, ep.path, params))
+}
+
+// routeError answers a request the router cannot serve with status, as JSON
+// such as {"error":"not found"} for API requests and as plain text otherwise.
+func routeError(w http.ResponseWriter, r *http.Request, status int) {
+	if !isAPIRequest(r) {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	requestJSON(w, r, status, map[string]string{"error": strings.ToLower(http.StatusText(status))})
+}
+
+// isAPIRequest reports whether r is for the API: every request in API mode,
+// otherwise those whose path is under one of the API prefixes.
+func isAPIRequest(r *http.Request) bool {
+	s := settingsFor(r)
+	if s.apiMode {
+		return true
+	}
+	for _, prefix := range s.apiPrefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the controller of the route that would serve a request with
+// method and path, and the values of the route's params. It ignores the
+// Accept header and the route's middleware, and exists mostly so routing can
+// be benchmarked and profiled in isolation from HTTP.
+func (r *Router) Match(method, path string) (ControllerFunc, map[string]string, bool) {
+	ep, params := r.match(path)
+	if ep == nil {
+		return nil, nil, false
+	}
+	route, _ := r.pick(ep, method, "")
+	if route == nil {
+		return nil, nil, false
+	}
+	return route.controller, params, true
+}
+
+// pick chooses the route of ep for method and accept; see endpoint.pick.
+func (r *Router) pick(ep *endpoint, method, accept string) (*Route, int) {
+	route, status := ep.pick(method, accept)
+	if status == http.StatusMethodNotAllowed && !r.strictMethods {
+		return pickMediaType(ep.routes, accept)
+	}
+	return route, status
+}
+
+// match finds the endpoint for path. Endpoints are kept sorted by
+// precedence, so the first that matches is the most specific; see
+// endpoint.precedes.
+func (r *Router) match(path string) (*endpoint, map[string]string) {
+	if ep, ok := r.routerMap[path]; ok && ep.static() {
+		return ep, nil
+	}
+
+	for _, ep := range r.order {
+		if params, ok := ep.match(path); ok {
+			return ep, params
+		}
+	}
+	return nil, nil
+}
+
+// endpoint holds every route registered for one path pattern.
+type endpoint struct {
+	path     string
+	segments []string
+	routes   []*Route
+}
+
+func newEndpoint(path string) *endpoint {
+	return &endpoint{
+		path:     path,
+		segments: strings.Split(strings.TrimPrefix(path, "/"), "/"),
+	}
+}
+
+// versioned reports whether any route of the endpoint is keyed by media type.
+func (ep *endpoint) versioned() bool {
+	for _, rt := range ep.routes {
+		if rt.mediaType != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// allow lists the methods the endpoint accepts, for the Allow header.
+func (ep *endpoint) allow() string {
+	var methods []string
+	for _, rt := range ep.routes {
+		if !containsString(methods, rt.method) {
+			methods = append(methods, rt.method)
+		}
+		if rt.method == http.MethodGet && !containsString(methods, http.MethodHead) {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	return strings.Join(methods, ", ")
+}
+
+// pick chooses the route for method and the Accept header value. A route
+// whose Produces media type the client explicitly accepts wins, the newest
+// version first. Otherwise a route without a media type is used, and failing
+// that the latest version. It returns 405 when no route handles the method
+// and 406 when the client accepts only vendor media types no route offers.
+func (ep *endpoint) pick(method, accept string) (*Route, int) {
+	var candidates []*Route
+	for _, rt := range ep.routes {
+		if rt.method == method || (method == http.MethodHead && rt.method == http.MethodGet) {
+			candidates = append(candidates, rt)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, http.StatusMethodNotAllowed
+	}
+	return pickMediaType(candidates, accept)
+}
+
+// pickMediaType chooses among routes for accept as described for pick.
+func pickMediaType(routes []*Route, accept string) (*Route, int) {
+	var accepted, latest, unversioned *Route
+	for _, rt := range routes {
+		if rt.mediaType == "" {
+			unversioned = rt
+			continue
+		}
+		if latest == nil || rt.version() >= latest.version() {
+			latest = rt
+		}
+		if acceptsMediaType(accept, rt.mediaType) && (accepted == nil || rt.version() >= accepted.version()) {
+			accepted = rt
+		}
+	}
+
+	switch {
+	case accepted != nil:
+		return accepted, http.StatusOK
+	case unversioned != nil:
+		return unversioned, http.StatusOK
+	case !acceptsNonVendor(accept):
+		return nil, http.StatusNotAcceptable
+	default:
+		return latest, http.StatusOK
+	}
+}
+
+// acceptsNonVendor reports whether an Accept header value is empty or lists,
+// with a non-zero quality, a media type other than a vendor type, such as
+// */* or application/json, which the latest version can satisfy.
+func acceptsNonVendor(accept string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		if mediaType == "" || strings.Contains(mediaType, "/vnd.") {
+			continue
+		}
+		if acceptsMediaType(accept, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Route is a single registered controller. Its methods configure the route
+// and return it so calls can be chained.
+type Route struct {
+	method     string
+	path       string
+	mediaType  string
+	controller ControllerFunc
+	router     *Router
+	middleware []alice.Constructor
+	authorize  func(r *http.Request) bool
+
+	once sync.Once
+	h    http.Handler
+}
+
+var mediaTypeVersion = regexp.MustCompile(`\.v(\d+)\b`)
+
+// Produces keys the route by the media type it serves, such as
+// "application/vnd.myapp.v2+json", so several versions of an API can share
+// a path and be chosen by the client's Accept header. When the client does
+// not name a version the route with the highest .vN wins.
+func (rt *Route) Produces(mediaType string) *Route {
+	rt.mediaType = mediaType
+	return rt
+}
+
+// version returns the N of a .vN in the route's media type, or 0.
+func (rt *Route) version() int {
+	m := mediaTypeVersion.FindStringSubmatch(rt.mediaType)
+	if m == nil {
+		return 0
+	}
+	v, _ := strconv.Atoi(m[1])
+	return v
+}
+
+// Use adds middleware that runs only for this route, after the global chain.
+func (rt *Route) Use(middleware ...alice.Constructor) *Route {
+	rt.middleware = append(rt.middleware, middleware...)
+	return rt
+}
+
+// NoCache stops browsers and proxies from caching the route's responses.
+func (rt *Route) NoCache() *Route {
+	return rt.Use(NoCacheHandler)
+}
+
+// Authorize sets a check that decides whether an authenticated request may
+// reach the controller. It runs after all middleware, so values placed in
+// the request context by authentication middleware are available, and
+// requests it rejects get a 403.
+func (rt *Route) Authorize(allow func(r *http.Request) bool) *Route {
+	rt.authorize = allow
+	return rt
+}
+
+// serve runs the route's handler, building it on first use.
+func (rt *Route) serve(w http.ResponseWriter, r *http.Request) {
+	rt.once.Do(func() {
+		rt.h = rt.handler()
+	})
+	rt.h.ServeHTTP(w, r)
+}
+
+// handler returns the route's controller wrapped in its middleware.
+func (rt *Route) handler() http.Handler {
+	var h http.Handler = http.HandlerFunc(rt.controller)
+	if allow := rt.authorize; allow != nil {
+		next := h
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allow(r) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	return alice.New(rt.middleware...).Then(h)
+}
+
+// Name registers the route under name with its router, so the router's
+// URLFor and the urlFor template helper can build URLs for it. Like
+// registering a pattern twice with http.ServeMux, using a name twice on one
+// router panics.
+func (rt *Route) Name(name string) *Route {
+	if existing, ok := rt.router.names[name]; ok {
+		panic(fmt.Sprintf("goweb: route name %q is already used by %s", name, existing.path))
+	}
+	rt.router.names[name] = rt
+	return rt
+}
+
+// URLFor builds the URL of the route named name on the router of the most
+// recently started server; see Router.URLFor.
+func URLFor(name string, params map[string]string) (string, error) {
+	return defaultSettings.Load().router.URLFor(name, params)
+}
+
+// URLFor builds the URL of the route registered under name, substituting
+// :param and *param segments of its pattern from params. Params that do not
+// appear in the pattern are added to the query string.
+func (r *Router) URLFor(name string, params map[string]string) (string, error) {
+	rt, ok := r.route(name)
+	if !ok {
+		return "", fmt.Errorf("goweb: no route named %q", name)
+	}
+
+	used := make(map[string]bool)
+	segments := strings.Split(rt.path, "/")
+	for i, seg := range segments {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		key := seg[1:]
+		value, ok := params[key]
+		if !ok {
+			return "", fmt.Errorf("goweb: missing param %q for route %q", key, name)
+		}
+		used[key] = true
+		if seg[0] == '*' {
+			parts := strings.Split(value, "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			segments[i] = strings.Join(parts, "/")
+		} else {
+			segments[i] = url.PathEscape(value)
+		}
+	}
+
+	u := strings.Join(segments, "/")
+	query := url.Values{}
+	for k, v := range params {
+		if !used[k] {
+			query.Set(k, v)
+		}
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u, nil
+}
+
+// route returns the route registered under name. It can be called on a nil
+// Router, which has no routes.
+func (r *Router) route(name string) (*Route, bool) {
+	if r == nil {
+		return nil, false
+	}
+	rt, ok := r.names[name]
+	return rt, ok
+}
+
+// urlFor is the template form of URLFor, for the router of the most recently
+// started server outside of Render; see Router.urlFor.
+func urlFor(name string, args ...interface{}) (string, error) {
+	return defaultSettings.Load().router.urlFor(name, args...)
+}
+
+// urlFor is the template form of Router.URLFor. It accepts either a single
+// map[string]string of params or the param values in the order they appear
+// in the route pattern: {{ urlFor "user.show" .ID }}.
+func (r *Router) urlFor(name string, args ...interface{}) (string, error) {
+	if len(args) == 1 {
+		if params, ok := args[0].(map[string]string); ok {
+			return r.URLFor(name, params)
+		}
+	}
+
+	rt, ok := r.route(name)
+	if !ok {
+		return "", fmt.Errorf("goweb: no route named %q", name)
+	}
+
+	params := make(map[string]string)
+	i := 0
+	for _, seg := range strings.Split(rt.path, "/") {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		if i >= len(args) {
+			break
+		}
+		params[seg[1:]] = fmt.Sprint(args[i])
+		i++
+	}
+	return r.URLFor(name, params)
+}
@@ -0,0 +1,359 @@
+package goweb
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// reply returns a controller writing body.
+func reply(body string) ControllerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}
+}
+
+func serve(h http.Handler, method, path string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRouterVersionedAccept(t *testing.T) {
+	router := NewRouter()
+	router.GET("/users", reply("v1")).Produces("application/vnd.myapp.v1+json")
+	router.GET("/users", reply("v2")).Produces("application/vnd.myapp.v2+json")
+
+	tests := []struct {
+		accept string
+		status int
+		body   string
+	}{
+		{"", http.StatusOK, "v2"},
+		{"application/vnd.myapp.v1+json", http.StatusOK, "v1"},
+		{"application/vnd.myapp.v2+json, application/vnd.myapp.v1+json", http.StatusOK, "v2"},
+		{"application/vnd.x.v9+json, */*", http.StatusOK, "v2"},
+		{"application/vnd.x.v9+json, application/json", http.StatusOK, "v2"},
+		{"application/vnd.x.v9+json, */*;q=0", http.StatusNotAcceptable, ""},
+		{"application/vnd.x.v9+json", http.StatusNotAcceptable, ""},
+	}
+	for _, tt := range tests {
+		w := serve(router, http.MethodGet, "/users", http.Header{"Accept": {tt.accept}})
+		if w.Code != tt.status || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("Accept %q: got %d %q, want %d %q", tt.accept, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept %q: Vary = %q", tt.accept, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestRouterMethods(t *testing.T) {
+	router := NewRouter()
+	router.GET("/items", reply("list"))
+	router.POST("/items", reply("create"))
+	router.GET("/legacy", reply("legacy"))
+
+	if w := serve(router, http.MethodHead, "/items", nil); w.Code != http.StatusOK {
+		t.Errorf("HEAD: status %d", w.Code)
+	}
+	if w := serve(router, http.MethodPost, "/items", nil); w.Body.String() != "create" {
+		t.Errorf("POST served %q", w.Body.String())
+	}
+	// a GET route still serves other methods, as it always has
+	if w := serve(router, http.MethodPost, "/legacy", nil); w.Code != http.StatusOK || w.Body.String() != "legacy" {
+		t.Errorf("POST to a GET route: status %d, body %q", w.Code, w.Body.String())
+	}
+
+	router.StrictMethods()
+	w := serve(router, http.MethodDelete, "/items", nil)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE with StrictMethods: status %d, want 405", w.Code)
+	}
+	if got := w.Header().Get("Allow"); got != "GET, HEAD, POST" {
+		t.Errorf("Allow = %q", got)
+	}
+	if w := serve(router, http.MethodPost, "/items", nil); w.Body.String() != "create" {
+		t.Errorf("POST with StrictMethods served %q", w.Body.String())
+	}
+}
+
+func TestRouterReregister(t *testing.T) {
+	router := NewRouter()
+	router.GET("/", reply("old"))
+	router.GET("/", reply("new"))
+
+	if w := serve(router, http.MethodGet, "/", nil); w.Body.String() != "new" {
+		t.Errorf("served %q, want the route registered last", w.Body.String())
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	router := NewRouter().StrictMethods()
+	router.GET("/users/:id", reply("user"))
+
+	if _, params, ok := router.Match(http.MethodGet, "/users/42"); !ok || params["id"] != "42" {
+		t.Errorf("Match(GET /users/42) = %v, %v", params, ok)
+	}
+	if _, _, ok := router.Match(http.MethodPost, "/users/42"); ok {
+		t.Error("Match(POST /users/42) matched a GET route")
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	router := NewRouter()
+	for _, p := range []string{"/", "/about", "/pricing", "/users", "/users/:id", "/users/:id/posts", "/users/:id/posts/:post", "/files/*path"} {
+		router.GET(p, reply(p))
+	}
+
+	paths := []struct{ name, path string }{
+		{"static", "/pricing"},
+		{"param", "/users/42/posts/7"},
+		{"catchall", "/files/css/site/app.css"},
+	}
+	for _, p := range paths {
+		b.Run(p.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, ok := router.Match(http.MethodGet, p.path); !ok {
+					b.Fatalf("%s did not match", p.path)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteNoCache(t *testing.T) {
+	router := NewRouter()
+	router.GET("/account", reply("balance")).NoCache()
+	router.GET("/about", reply("about"))
+
+	w := serve(router, http.MethodGet, "/account", nil)
+	want := map[string]string{
+		"Cache-Control": "no-store, no-cache, must-revalidate",
+		"Pragma":        "no-cache",
+		"Expires":       "0",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+
+	w = serve(router, http.MethodGet, "/about", nil)
+	if got := w.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("unmarked route got Cache-Control %q", got)
+	}
+}
+
+func TestRouteUse(t *testing.T) {
+	var order []string
+	mark := func(name string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	router := NewRouter()
+	router.GET("/admin", func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "controller")
+	}).Use(mark("auth"), mark("audit"))
+	router.GET("/public", reply("public"))
+
+	serve(router, http.MethodGet, "/admin", nil)
+	if got := strings.Join(order, ","); got != "auth,audit,controller" {
+		t.Errorf("order = %s, want auth,audit,controller", got)
+	}
+
+	order = nil
+	serve(router, http.MethodGet, "/public", nil)
+	if len(order) != 0 {
+		t.Errorf("route middleware ran for another route: %v", order)
+	}
+}
+
+func TestRouterMerge(t *testing.T) {
+	web := NewRouter()
+	web.GET("/about", reply("about"))
+	api := NewRouter()
+	api.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "user "+Param(r, "id"))
+	})
+	if err := web.Merge("/api/", api); err != nil {
+		t.Fatal(err)
+	}
+
+	// both routers are served by the one chain Start builds
+	h := handler(Config{Router: web})
+	for path, want := range map[string]string{"/about": "about", "/api/users/7": "user 7"} {
+		if w := serve(h, http.MethodGet, path, nil); w.Body.String() != want {
+			t.Errorf("%s served %q, want %q", path, w.Body.String(), want)
+		}
+	}
+
+	tests := []struct {
+		name, pattern string
+		method        string
+		wantErr       string
+	}{
+		{"same route", "/users/:id", http.MethodGet, "already registered"},
+		{"renamed param", "/users/:uid", http.MethodGet, "conflicts with /api/users/:id"},
+		{"renamed param other method", "/users/:uid", http.MethodPost, "conflicts with /api/users/:id"},
+		{"same path other method", "/users/:id", http.MethodPost, ""},
+		{"more specific", "/users/new", http.MethodGet, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := NewRouter()
+			other.Handle(tt.method, tt.pattern, reply("merged"))
+			before := len(web.order)
+			err := web.Merge("/api", other)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			case tt.wantErr != "" && len(web.order) != before:
+				t.Error("failed Merge changed the router")
+			}
+		})
+	}
+}
+
+func TestURLFor(t *testing.T) {
+	router := NewRouter()
+	router.GET("/users/:id", reply("user")).Name("user.show")
+	router.GET("/files/*path", reply("file")).Name("file")
+	router.GET("/", reply("home")).Name("home")
+
+	tests := []struct {
+		name    string
+		route   string
+		params  map[string]string
+		want    string
+		wantErr string
+	}{
+		{"param", "user.show", map[string]string{"id": "42"}, "/users/42", ""},
+		{"escaped param", "user.show", map[string]string{"id": "a b/c"}, "/users/a%20b%2Fc", ""},
+		{"catch-all keeps slashes", "file", map[string]string{"path": "css/app v2.css"}, "/files/css/app%20v2.css", ""},
+		{"extra params in query", "user.show", map[string]string{"id": "1", "tab": "posts"}, "/users/1?tab=posts", ""},
+		{"missing param", "user.show", nil, "", `missing param "id"`},
+		{"unknown route", "nope", nil, "", `no route named "nope"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := router.URLFor(tt.route, tt.params)
+			switch {
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			case tt.wantErr == "" && (err != nil || got != tt.want):
+				t.Errorf("URLFor = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if got, err := router.urlFor("user.show", 7); err != nil || got != "/users/7" {
+		t.Errorf("urlFor with a positional param = %q, %v", got, err)
+	}
+	if got, err := router.urlFor("user.show", map[string]string{"id": "8"}); err != nil || got != "/users/8" {
+		t.Errorf("urlFor with a param map = %q, %v", got, err)
+	}
+}
+
+func TestURLForPerRouter(t *testing.T) {
+	a, b := NewRouter(), NewRouter()
+	a.GET("/a", reply("a")).Name("home")
+	b.GET("/b", reply("b")).Name("home")
+
+	// each router resolves its own names
+	if got, _ := a.URLFor("home", nil); got != "/a" {
+		t.Errorf("router a: URLFor(home) = %q", got)
+	}
+	// the package-level form follows the router being served
+	handler(Config{Router: a})
+	if got, _ := URLFor("home", nil); got != "/a" {
+		t.Errorf("serving router a: URLFor(home) = %q", got)
+	}
+
+	// a name used twice on one router is a programming error
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("reusing a route name did not panic")
+			}
+		}()
+		a.GET("/other", reply("other")).Name("home")
+	}()
+
+	// and merging routers with the same name fails
+	if err := a.Merge("/b", b); err == nil || !strings.Contains(err.Error(), `"home"`) {
+		t.Errorf("Merge with a duplicate name: %v", err)
+	}
+}
+
+func TestURLForTemplate(t *testing.T) {
+	withTemplates(t, map[string]string{"link.html": `<a href="{{urlFor "user.show" .id}}">`})
+
+	router := NewRouter()
+	router.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		RenderWithContentType(r, w, "", []string{"link.html"}, map[string]interface{}{"id": 5})
+	}).Name("user.show")
+	other := NewRouter()
+	other.GET("/people/:id", reply("")).Name("user.show")
+
+	h := handler(Config{Router: router})
+	handler(Config{Router: other}) // started later, but not serving this request
+
+	if got := serve(h, http.MethodGet, "/users/1", nil).Body.String(); got != `<a href="/users/5">` {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestRouteErrorsAsJSON(t *testing.T) {
+	newRouter := func() *Router {
+		router := NewRouter().StrictMethods()
+		router.GET("/api/users", reply("users"))
+		router.GET("/pages/about", reply("about"))
+		return router
+	}
+
+	tests := []struct {
+		name         string
+		cfg          Config
+		method, path string
+		status       int
+		body         string
+	}{
+		{"api 404", Config{APIPrefixes: []string{"/api/"}}, http.MethodGet, "/api/foo", http.StatusNotFound, `{"error":"not found"}`},
+		{"api 405", Config{APIPrefixes: []string{"/api"}}, http.MethodDelete, "/api/users", http.StatusMethodNotAllowed, `{"error":"method not allowed"}`},
+		{"prefix needs a segment boundary", Config{APIPrefixes: []string{"/api"}}, http.MethodGet, "/apiary", http.StatusNotFound, "Not Found"},
+		{"web 404", Config{APIPrefixes: []string{"/api"}}, http.MethodGet, "/pages/missing", http.StatusNotFound, "Not Found"},
+		{"api mode", Config{APIMode: true}, http.MethodGet, "/pages/missing", http.StatusNotFound, `{"error":"not found"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Router = newRouter()
+			w := serve(handler(cfg), tt.method, tt.path, nil)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+			wantJSON := strings.HasPrefix(tt.body, "{")
+			if isJSON := strings.HasPrefix(w.Header().Get("Content-Type"), "application/json"); isJSON != wantJSON {
+				t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -1,17 +1,24 @@
 package goweb
 
 import (
+	"bufio"
 	"compress/gzip"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"io"
 	"log"
+	"net"
 	"net/http"
+	"reflect"
 	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/justinas/alice"
+	logger "github.com/phil-inc/plog-ng/pkg/core"
+	"golang.org/x/net/netutil"
 )
 
 type Config struct {
@@ -19,67 +26,234 @@ type Config struct {
 	Port               string
 	StaticFilesDirPath string
 	ViewsDirPath       string
-}
-
-type ControllerFunc func(w http.ResponseWriter, r *http.Request)
 
-type Router struct {
-	routerMap map[string]ControllerFunc
+	// GzipContentTypes restricts compression to the listed content types.
+	// When empty, everything except known incompressible types is compressed.
+	GzipContentTypes []string
+
+	// GzipOmitVary stops compression adding Accept-Encoding to Vary.
+	GzipOmitVary bool
+
+	// TrustedProxyCount is the number of reverse proxies in front of the app,
+	// used by ClientIP to pick the client's entry in X-Forwarded-For.
+	TrustedProxyCount int
+
+	// SkipLogPaths and SkipLogMethods are left out of the request log, e.g.
+	// health check paths and OPTIONS preflight requests.
+	SkipLogPaths   []string
+	SkipLogMethods []string
+
+	// StreamingPaths are exempt from the handler timeout, whose buffering
+	// would otherwise hold back every byte until the handler returns, so
+	// handlers such as those using StreamJSON can flush as they go. Entries
+	// ending in "/" exempt every path below them. Upgrade requests, e.g. for
+	// websockets, are always exempt.
+	StreamingPaths []string
+
+	// ServerHeader is sent as the Server header on every response. When empty
+	// no Server header is sent.
+	ServerHeader string
+
+	// MaxConnections, when positive, caps the number of concurrent client
+	// connections. Further connections wait until one is closed.
+	MaxConnections int
+
+	// CanonicalizeHost normalizes the Host header before it is checked or
+	// used. See CanonicalHostHandler.
+	CanonicalizeHost bool
+
+	// AllowedHosts, when non-empty, rejects requests whose Host header does
+	// not match one of the listed hosts. See AllowedHostsHandler.
+	AllowedHosts []string
+
+	// HealthCheckPaths are exempt from host and availability checks so load
+	// balancers can always reach them.
+	HealthCheckPaths []string
+
+	// Maintenance configures the page served while maintenance mode is on.
+	// HealthCheckPaths are always allowed through. See SetMaintenance.
+	Maintenance MaintenanceConfig
+
+	// ResponseCache, when set, caches successful GET responses, compressed,
+	// in a pluggable store. See NewResponseCacheHandler.
+	ResponseCache *ResponseCacheConfig
+
+	// JSONOptions configures the output of the JSON helper.
+	JSONOptions JSONOptions
+
+	// MaxBodyBytes, when positive, limits the size of request bodies.
+	MaxBodyBytes int64
+
+	// BodyTooLargeResponder and DecodeErrorResponder override the 413 and
+	// 400 responses BindJSON sends. The defaults write a JSON error.
+	BodyTooLargeResponder ErrorResponder
+	DecodeErrorResponder  ErrorResponder
+
+	// SlowRenderThreshold, when positive, makes Render log a warning for
+	// renders that take longer, including the template files involved.
+	SlowRenderThreshold time.Duration
+
+	// ResponseWriterWrapper, when set, wraps the ResponseWriter at the top of
+	// the chain so every middleware and handler sees the wrapper. Wrappers
+	// should implement http.Flusher and http.Hijacker when the writer they
+	// wrap does. Handlers only reach those methods on StreamingPaths and
+	// upgrade requests, since the handler timeout buffers everything else.
+	ResponseWriterWrapper func(http.ResponseWriter) http.ResponseWriter
+
+	// PanicBodySnapshot includes a truncated, redacted copy of the request
+	// body in panic reports. Off by default since bodies may hold personal
+	// data.
+	PanicBodySnapshot bool
+
+	// APIMode makes the router answer unmatched paths and methods with JSON
+	// bodies such as {"error":"not found"} instead of plain text. APIPrefixes
+	// does the same only for paths under the given prefixes, e.g. "/api", for
+	// apps that serve pages and an API.
+	APIMode     bool
+	APIPrefixes []string
+
+	// AssetsRoot is the URL path the assetPath helper puts assets under.
+	// Defaults to "/public/assets"; see SetAssetsRoot.
+	AssetsRoot string
+
+	// StrictTemplateVars makes rendering fail, through the usual template
+	// error response, when a template reads a key missing from its data
+	// instead of printing "<no value>". Useful in development.
+	StrictTemplateVars bool
+
+	// TLSCertFile and TLSKeyFile, when set, serve HTTPS with the PEM encoded
+	// certificate and key in these files. Replacing the files, e.g. on
+	// renewal, takes effect within a few seconds, without a restart.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// DevMode enables development aids such as request body logging and
+	// detailed panic pages. Never enable it in production.
+	DevMode bool
 }
 
-func NewRouter() *Router {
-	r := new(Router)
-	r.routerMap = make(map[string]ControllerFunc)
-	return r
-}
+func Start(cfg Config) {
+	log.Print("Setting up static file server")
 
-func (r *Router) routes() map[string]ControllerFunc {
-	return r.routerMap
-}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.Port))
+	if err != nil {
+		log.Panicf("Error starting server: %s\n", err)
+	}
 
-func (r *Router) GET(path string, controller ControllerFunc) {
-	r.routerMap[path] = controller
+	println("Server running...")
+	if err := Serve(cfg, ln); err != nil {
+		log.Panicf("Error starting server: %s\n", err)
+	}
 }
 
-func Start(cfg Config) {
-	log.Print("Setting up static file server")
-
+// Serve serves the application described by cfg on ln, ignoring cfg.Port.
+// It lets tests use an ephemeral port and deployments pass in a
+// socket-activated or otherwise wrapped listener. It serves HTTPS when
+// cfg.TLSCertFile and cfg.TLSKeyFile are set. Like http.Server.Serve it
+// closes ln and always returns a non-nil error.
+//
+// Several servers can run at once, e.g. HTTP next to HTTPS or an admin port,
+// each with its own Config. Helpers that take no request, such as JSON, use
+// the settings of the most recently started one.
+func Serve(cfg Config, ln net.Listener) error {
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%s", cfg.Port),
+		Addr:         ln.Addr().String(),
 		ReadTimeout:  4 * time.Minute,
 		WriteTimeout: 4 * time.Minute,
 		Handler:      handler(cfg),
+		ConnState:    trackConnState,
 	}
 
-	println("Server running...")
-	if err := srv.ListenAndServe(); err != nil {
-		log.Panicf("Error starting server: %s\n", err)
+	if cfg.MaxConnections > 0 {
+		// connections over the limit wait to be accepted until one closes
+		ln = netutil.LimitListener(ln, cfg.MaxConnections)
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		certs, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.getCertificate,
+		}
+		return srv.ServeTLS(ln, "", "")
 	}
+	return srv.Serve(ln)
 }
 
 func routes(cfg Config) *http.ServeMux {
 	mux := http.NewServeMux()
 
-	mux.Handle("/css/", http.FileServer(http.Dir(cfg.StaticFilesDirPath)))
+	mux.Handle("/css/", staticHandler(cfg.StaticFilesDirPath, cfg.GzipOmitVary))
 
-	for path, handler := range cfg.Router.routes() {
-		mux.HandleFunc(path, handler)
-	}
+	mux.Handle("/", cfg.Router)
 
 	return mux
 }
 
+// handler builds the middleware chain in front of the router. Middleware runs
+// in the order it is listed, before any route is matched: the server's
+// settings and the request value bag, the optional writer wrapper and Server header, then timeout, panic
+// recovery and request metrics, then the request filters such as the host
+// allow-list and maintenance mode, then the response cache and compression.
+// Filters that answer a request themselves stop the chain there, and because
+// they sit inside RequestMetricsHandler their responses are still logged with
+// their status.
 func handler(cfg Config) http.Handler {
-	handlers := []alice.Constructor{
-		TimeoutHandler,
+	s := newSettings(cfg)
+	defaultSettings.Store(s)
+
+	handlers := []alice.Constructor{settingsHandler(s), ValuesHandler}
+	if cfg.ResponseWriterWrapper != nil {
+		handlers = append(handlers, responseWriterWrapperHandler(cfg.ResponseWriterWrapper))
+	}
+	if cfg.ServerHeader != "" {
+		handlers = append(handlers, ServerHeaderHandler(cfg.ServerHeader))
+	}
+	handlers = append(handlers,
+		NewTimeoutHandler(cfg.StreamingPaths...),
 		RecoverHandler,
-		RequestMetricsHandler,
-		GZipHandler,
+		NewRequestMetricsHandler(cfg.SkipLogPaths, cfg.SkipLogMethods),
+	)
+	if cfg.CanonicalizeHost {
+		handlers = append(handlers, CanonicalHostHandler)
+	}
+	if len(cfg.AllowedHosts) > 0 {
+		handlers = append(handlers, AllowedHostsHandler(cfg.AllowedHosts, cfg.HealthCheckPaths...))
+	}
+
+	maintenanceCfg := cfg.Maintenance
+	maintenanceCfg.AllowPaths = append(append([]string{}, cfg.HealthCheckPaths...), maintenanceCfg.AllowPaths...)
+	handlers = append(handlers, MaintenanceHandler(maintenanceCfg))
+
+	if cfg.ResponseCache != nil {
+		handlers = append(handlers, NewResponseCacheHandler(*cfg.ResponseCache))
+	}
+	handlers = append(handlers, NewGZipHandler(GZipConfig{ContentTypes: cfg.GzipContentTypes, OmitVary: cfg.GzipOmitVary}))
+
+	if cfg.MaxBodyBytes > 0 {
+		handlers = append(handlers, MaxBodyHandler(cfg.MaxBodyBytes))
+	}
+	if cfg.DevMode {
+		handlers = append(handlers, BodyLogHandler)
 	}
 
 	return alice.New(handlers...).Then(routes(cfg))
 }
 
+// responseWriterWrapperHandler passes a wrapped ResponseWriter down the chain.
+func responseWriterWrapperHandler(wrap func(http.ResponseWriter) http.ResponseWriter) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(wrap(w), r)
+		}
+		return http.HandlerFunc(f)
+	}
+}
+
 // RecoverHandler is a deferred function that will recover from the panic,
 // respond with a HTTP 500 error and log the panic. When our code panics in production
 // (make sure it should not but we can forget things sometimes) our application
@@ -87,6 +261,15 @@ func handler(cfg Config) http.Handler {
 // It's pretty easy with Go and our middleware system.
 func RecoverHandler(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		rec := newStatusRecorder(w)
+		s := settingsFor(r)
+
+		var body *bodyTee
+		if s.panicBodySnapshot && r.Body != nil && r.Body != http.NoBody {
+			body = newBodyTee(r.Body, maxLoggedBodyBytes)
+			r.Body = body
+		}
+
 		defer func() {
 			if rr := recover(); rr != nil {
 				var err error
@@ -98,77 +281,430 @@ func RecoverHandler(next http.Handler) http.Handler {
 				default:
 					err = errors.New("unknown panic")
 				}
+
+				// once the handler has started the response it can no longer
+				// be replaced, writing an error now would only corrupt it
+				responseStarted := rec.headerWritten()
+
+				stack := debug.Stack()
+
+				// a mapped panic is flow control rather than a crash, but it
+				// still has to be traceable
+				if status, ok := panicStatus(rr); ok && !responseStarted {
+					logger.Warnf("panic mapped to %d for %s: %v\n%s", status, r.RequestURI, err, stack)
+					http.Error(w, http.StatusText(status), status)
+					return
+				}
+
 				eh := ErrorHandler{}
 				if err != nil {
 					perr := fmt.Errorf("PANIC: %s", err.Error())
 					eh.HandleError(r, perr)
 
 					// send stack trace as well
-					if etrace := debug.Stack(); etrace != nil {
-						etrace := fmt.Errorf("STACKTRACE: %s", debug.Stack())
+					if stack != nil {
+						etrace := fmt.Errorf("STACKTRACE: %s", stack)
 						debug.PrintStack()
 						eh.HandleError(r, etrace)
 					}
+
+					// and what the request carried, for reproducing it
+					if body != nil {
+						body.drain(r.Context())
+						eh.HandleError(r, fmt.Errorf("REQUEST BODY: %s", body.snapshot()))
+					}
+				}
+
+				if responseStarted {
+					log.Printf("Panic after response started, abandoning response: %s", r.RequestURI)
+					return
+				}
+
+				// never leak the stack trace outside of development
+				if s.devMode {
+					writeDebugPage(w, r, err, stack)
+					return
 				}
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
 		}()
 
 		if next != nil {
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(rec, r)
 		}
 	}
 
 	return http.HandlerFunc(fn)
 }
 
+// panicStatuses maps the types of registered panic values to HTTP statuses.
+var panicStatuses sync.Map
+
+// RegisterPanicStatus makes RecoverHandler respond with status instead of a
+// 500 when a handler panics with a value of the same type as sample, for code
+// that uses panics for flow control such as not found or forbidden. Error
+// values are also matched against the errors they wrap.
+func RegisterPanicStatus(sample interface{}, status int) {
+	panicStatuses.Store(reflect.TypeOf(sample), status)
+}
+
+// panicStatus returns the status registered for the recovered value v.
+func panicStatus(v interface{}) (int, bool) {
+	for v != nil {
+		if status, ok := panicStatuses.Load(reflect.TypeOf(v)); ok {
+			return status.(int), true
+		}
+		err, ok := v.(error)
+		if !ok {
+			break
+		}
+		next := errors.Unwrap(err)
+		if next == nil {
+			break
+		}
+		v = next
+	}
+	return 0, false
+}
+
+// defaultGzipExcludedTypes lists content types that are already compressed and
+// gain nothing from another pass through gzip.
+var defaultGzipExcludedTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/pdf",
+	"application/octet-stream",
+}
+
+// GZipConfig controls which responses GZipHandler compresses.
+type GZipConfig struct {
+	// ContentTypes is an allow-list of compressible content types. When it is
+	// non-empty only matching responses are compressed; when it is empty every
+	// response is compressed except the known incompressible types. Entries
+	// ending in "/" or "/*" match a whole type, e.g. "text/*".
+	ContentTypes []string
+
+	// OmitVary stops the handler adding Accept-Encoding to the Vary header,
+	// for deployments that manage caching headers themselves.
+	OmitVary bool
+}
+
+// shouldCompress reports whether a response with the given content type
+// should be compressed.
+func (c GZipConfig) shouldCompress(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if len(c.ContentTypes) > 0 {
+		return matchContentType(mediaType, c.ContentTypes)
+	}
+	return !matchContentType(mediaType, defaultGzipExcludedTypes)
+}
+
+// matchContentType reports whether mediaType matches any of the patterns.
+func matchContentType(mediaType string, patterns []string) bool {
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSuffix(p, "*"))
+		if strings.HasSuffix(p, "/") {
+			if strings.HasPrefix(mediaType, p) {
+				return true
+			}
+		} else if mediaType == p {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter defers the decision to compress until the response
+// headers are known, so the content type can be inspected first.
 type gzipResponseWriter struct {
-	io.Writer
 	http.ResponseWriter
+	cfg      GZipConfig
+	gz       *gzip.Writer
+	decided  bool
+	compress bool
+
+	// gzipETags are the identity forms of the gzip ETags the client sent in
+	// If-None-Match; see gzipConditional.
+	gzipETags map[string]bool
 }
 
-func (w gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+func (w *gzipResponseWriter) decide(status int) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	h := w.Header()
+	if !w.cfg.OmitVary {
+		// the handler may have replaced Vary after the middleware set it
+		addVary(h, "Accept-Encoding")
+	}
+	if status == http.StatusNotModified {
+		// the client's copy is the compressed one if it matched a gzip ETag
+		if etag := h.Get("ETag"); w.gzipETags[etag] {
+			h.Set("ETag", gzipETag(etag))
+		}
+		return
+	}
+	if status < http.StatusOK || status == http.StatusNoContent {
+		return
+	}
+	if status == http.StatusPartialContent || h.Get("Content-Range") != "" {
+		// Content-Range gives offsets into the uncompressed body
+		return
+	}
+	if h.Get("Content-Encoding") != "" || !w.cfg.shouldCompress(h.Get("Content-Type")) {
+		return
+	}
+
+	w.compress = true
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	if etag := h.Get("ETag"); etag != "" {
+		// the compressed bytes differ, so they must not share a validator
+		// with the uncompressed response
+		h.Set("ETag", gzipETag(etag))
+	}
+	w.gz = gzip.NewWriter(w.ResponseWriter)
 }
 
-func GZipHandler(h http.Handler) http.Handler {
-	f := func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			h.ServeHTTP(w, r) // serve the original request
-			return
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	w.decide(status)
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
 		}
+		w.decide(http.StatusOK)
+	}
+	if w.compress {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered compressed data to the client.
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
 
-		w.Header().Set("Content-Encoding", "gzip")
+// Hijack lets the underlying connection be taken over, e.g. for websockets.
+func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("goweb: underlying ResponseWriter does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// Close flushes any pending compressed data.
+func (w *gzipResponseWriter) Close() error {
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
+}
+
+// gzipETag returns the ETag of the gzipped form of the response tagged etag.
+func gzipETag(etag string) string {
+	if !strings.HasSuffix(etag, `"`) || strings.HasSuffix(etag, `-gzip"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + `-gzip"`
+}
 
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
+// gzipConditional lets the handler match the gzip ETags in r's If-None-Match
+// against the identity ETag it sets: it adds the identity form of each to the
+// header and returns them. The gzip ETags are kept for handlers that tag
+// compressed responses themselves, such as the static file server.
+func gzipConditional(r *http.Request) (*http.Request, map[string]bool) {
+	inm := r.Header.Get("If-None-Match")
+	if !strings.Contains(inm, `-gzip"`) {
+		return r, nil
+	}
 
-		gzw := gzipResponseWriter{Writer: gz, ResponseWriter: w}
-		h.ServeHTTP(gzw, r) // serve the original request
+	tags := make(map[string]bool)
+	var identity []string
+	for _, tag := range strings.Split(inm, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasSuffix(tag, `-gzip"`) {
+			t := strings.TrimSuffix(tag, `-gzip"`) + `"`
+			tags[t] = true
+			identity = append(identity, t)
+		}
 	}
-	return http.HandlerFunc(f)
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Header = r.Header.Clone()
+	r2.Header.Set("If-None-Match", inm+", "+strings.Join(identity, ", "))
+	return r2, tags
 }
 
+// GZipHandler compresses responses for clients that accept gzip, skipping
+// content types that are already compressed.
+func GZipHandler(h http.Handler) http.Handler {
+	return NewGZipHandler(GZipConfig{})(h)
+}
+
+// NewGZipHandler returns a compression middleware configured by c.
+func NewGZipHandler(c GZipConfig) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			// merge with, rather than replace, any Vary set by other middleware
+			if !c.OmitVary {
+				addVary(w.Header(), "Accept-Encoding")
+			}
+
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || r.Method == http.MethodHead {
+				h.ServeHTTP(w, r) // serve the original request
+				return
+			}
+
+			gzw := &gzipResponseWriter{ResponseWriter: w, cfg: c}
+			r, gzw.gzipETags = gzipConditional(r)
+			// also runs when the handler panics, ending a started gzip
+			// stream so it stays decodable
+			defer gzw.Close()
+
+			h.ServeHTTP(gzw, r) // serve the original request
+		}
+		return http.HandlerFunc(f)
+	}
+}
+
+// ServerHeaderHandler sets the Server header to value on every response.
+// Handlers may still override it.
+func ServerHeaderHandler(value string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", value)
+			h.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(f)
+	}
+}
+
+// handlerTimeout is how long TimeoutHandler lets a request run.
+const handlerTimeout = 4 * time.Second
+
+// TimeoutHandler fails requests that take longer than the handler timeout
+// with a 503. It buffers the response until the handler returns, so the
+// writer it passes on cannot flush or be hijacked; see NewTimeoutHandler for
+// exempting streaming endpoints.
 func TimeoutHandler(h http.Handler) http.Handler {
-	return http.TimeoutHandler(h, 4*time.Second, "timed out")
+	return http.TimeoutHandler(h, handlerTimeout, "timed out")
+}
+
+// NewTimeoutHandler returns a TimeoutHandler that lets requests for
+// streamingPaths, and websocket and other upgrade requests, through without a
+// timeout, so their handlers can flush partial responses, as StreamJSON and
+// server-sent events do, or hijack the connection. Paths ending in "/" exempt
+// every path below them.
+func NewTimeoutHandler(streamingPaths ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		timeout := TimeoutHandler(h)
+		f := func(w http.ResponseWriter, r *http.Request) {
+			if isUpgradeRequest(r) || matchPath(streamingPaths, r.URL.Path) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			timeout.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(f)
+	}
+}
+
+// isUpgradeRequest reports whether r asks to switch protocols, e.g. to a
+// websocket.
+func isUpgradeRequest(r *http.Request) bool {
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPath reports whether path is one of paths or, for entries ending in
+// "/", below one of them.
+func matchPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
 }
 
 func RequestMetricsHandler(h http.Handler) http.Handler {
-	logFn := func(rw http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+	return NewRequestMetricsHandler(nil, nil)(h)
+}
 
-		uri := r.RequestURI
-		method := r.Method
+// NewRequestMetricsHandler returns a RequestMetricsHandler that does not log
+// requests for skipPaths or using skipMethods, such as health checks and
+// CORS preflight OPTIONS requests, keeping the access log signal-rich. Each
+// log line ends with the request's value bag as it stands when the handler
+// returns, so values set with Set or by ContextValueHandler, such as a tenant
+// ID, can be traced in the logs.
+func NewRequestMetricsHandler(skipPaths, skipMethods []string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		logFn := func(rw http.ResponseWriter, r *http.Request) {
+			if containsString(skipPaths, r.URL.Path) || containsString(skipMethods, r.Method) {
+				h.ServeHTTP(rw, r)
+				return
+			}
 
-		h.ServeHTTP(rw, r) // serve the original request
+			start := time.Now()
 
-		duration := time.Since(start)
+			uri := r.RequestURI
+			method := r.Method
 
-		// log request details
-		log.Printf("Request: %s %s %d", uri, method, duration)
+			rec := newStatusRecorder(rw)
+			h.ServeHTTP(rec, r) // serve the original request
+
+			duration := time.Since(start)
+
+			// log request details, with the value bag the chain has filled in
+			log.Printf("Request: %s %s %d %d%s", uri, method, rec.statusCode(), duration, logValues(contextValues(r)))
+		}
+
+		return http.HandlerFunc(logFn)
 	}
+}
+
+// logValues formats the request value bag for the request log as
+// " key=value" pairs sorted by key.
+func logValues(m map[string]interface{}) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-	return http.HandlerFunc(logFn)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, m[k])
+	}
+	return b.String()
 }
 
 // ErrorHandler Error handler for routers and middlewares
@@ -0,0 +1,335 @@
+package goweb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// forwardingWriter is a ResponseWriterWrapper recording calls to the
+// optional interfaces it forwards.
+type forwardingWriter struct {
+	http.ResponseWriter
+	flushed  bool
+	hijacked bool
+}
+
+func (w *forwardingWriter) Flush() {
+	w.flushed = true
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *forwardingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func TestResponseWriterWrapperForwarding(t *testing.T) {
+	var wrapped *forwardingWriter
+	wrap := func(w http.ResponseWriter) http.ResponseWriter {
+		wrapped = &forwardingWriter{ResponseWriter: w}
+		return wrapped
+	}
+
+	router := NewRouter()
+	router.GET("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+	})
+	router.GET("/socket", func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\nhello")
+		buf.Flush()
+	})
+
+	srv := httptest.NewServer(handler(Config{
+		Router:                router,
+		ResponseWriterWrapper: wrap,
+		StreamingPaths:        []string{"/events"},
+	}))
+	defer srv.Close()
+
+	t.Run("flush", func(t *testing.T) {
+		res, err := http.Get(srv.URL + "/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if !wrapped.flushed {
+			t.Error("Flush did not reach the wrapper")
+		}
+	})
+
+	t.Run("hijack", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		io.WriteString(conn, "GET /socket HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+
+		data, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), "HTTP/1.1 101") || !strings.HasSuffix(string(data), "hello") {
+			t.Errorf("response = %q", data)
+		}
+		if !wrapped.hijacked {
+			t.Error("Hijack did not reach the wrapper")
+		}
+	})
+}
+
+func TestGZipHandlerPanic(t *testing.T) {
+	router := NewRouter()
+	router.GET("/before", func(w http.ResponseWriter, r *http.Request) {
+		panic("before writing")
+	})
+	router.GET("/after", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "partial output")
+		panic("after writing")
+	})
+
+	t.Run("before writing", func(t *testing.T) {
+		h := handler(Config{Router: router})
+		r := httptest.NewRequest(http.MethodGet, "/before", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want 500", w.Code)
+		}
+		if enc := w.Header().Get("Content-Encoding"); enc != "" {
+			t.Errorf("error response has Content-Encoding %q", enc)
+		}
+	})
+
+	t.Run("after writing", func(t *testing.T) {
+		h := handler(Config{Router: router})
+		r := httptest.NewRequest(http.MethodGet, "/after", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("gzip stream not terminated: %v", err)
+		}
+		if string(body) != "partial output" {
+			t.Errorf("body = %q", body)
+		}
+	})
+
+	t.Run("debug page names the controller", func(t *testing.T) {
+		h := handler(Config{Router: router, DevMode: true})
+		r := httptest.NewRequest(http.MethodGet, "/before", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if !regexp.MustCompile(`in <code>[^<]*TestGZipHandlerPanic`).MatchString(w.Body.String()) {
+			t.Errorf("debug page does not name the panicking controller:\n%s", w.Body.String())
+		}
+	})
+}
+
+func TestRecoverHandlerBodySnapshot(t *testing.T) {
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	withSettings(t, Config{PanicBodySnapshot: true})
+
+	h := RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// read only part of the body before failing
+		io.ReadFull(r.Body, make([]byte, 4))
+		panic("boom")
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(`{"amount":10,"card_number":4111111111111111}`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if !strings.Contains(logged.String(), `REQUEST BODY: {"amount":10,"card_number":"[REDACTED]"}`) {
+		t.Errorf("body snapshot missing or not redacted in log:\n%s", logged.String())
+	}
+	if strings.Contains(logged.String(), "4111") {
+		t.Error("card number leaked into the log")
+	}
+}
+
+func TestRecoverHandlerProdHidesDetails(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// restores the defaults handler replaces
+	withSettings(t, Config{})
+
+	router := NewRouter()
+	router.POST("/pay", func(w http.ResponseWriter, r *http.Request) {
+		panic("db password is hunter2")
+	})
+	h := handler(Config{Router: router, DevMode: false})
+
+	r := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(`{"amount":10}`))
+	r.Header.Set("Authorization", "Bearer secret-token")
+	r.Header.Set("Cookie", "session=secret-session")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if got, want := w.Body.String(), "Internal Server Error\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	for _, leak := range []string{"hunter2", "goroutine", ".go:", "secret-token", "secret-session", "amount"} {
+		if strings.Contains(w.Body.String(), leak) {
+			t.Errorf("response leaks %q", leak)
+		}
+	}
+}
+func TestServeSeveralServers(t *testing.T) {
+	router := NewRouter()
+	router.GET("/ping", reply("ok"))
+
+	// an app and its admin port, with different settings, side by side
+	site, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer site.Close()
+	defer admin.Close()
+	go Serve(Config{Router: router}, site)
+	go Serve(Config{Router: router, APIMode: true}, admin)
+
+	get := func(ln net.Listener, path string) (string, string) {
+		t.Helper()
+		res, err := http.Get("http://" + ln.Addr().String() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.Header.Get("Content-Type"), string(body)
+	}
+
+	for _, ln := range []net.Listener{site, admin} {
+		if _, body := get(ln, "/ping"); body != "ok" {
+			t.Errorf("%s: body = %q", ln.Addr(), body)
+		}
+	}
+
+	// each server answers with its own settings, whichever started last
+	if ct, _ := get(site, "/missing"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("site 404 Content-Type = %q, want text/plain", ct)
+	}
+	if ct, body := get(admin, "/missing"); !strings.HasPrefix(ct, "application/json") || body != `{"error":"not found"}`+"\n" {
+		t.Errorf("admin 404 = %q %q, want JSON", ct, body)
+	}
+}
+
+func TestRequestMetricsLogsValues(t *testing.T) {
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	h := ValuesHandler(RequestMetricsHandler(ContextValueHandler(HeaderExtractor("tenant", "X-Tenant-ID"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Set(r, "user", "alice")
+		}))))
+	serve(h, http.MethodGet, "/", http.Header{"X-Tenant-Id": {"acme"}})
+
+	if !strings.Contains(logged.String(), " tenant=acme user=alice") {
+		t.Errorf("request log does not carry the value bag:\n%s", logged.String())
+	}
+}
+
+func TestGZipContentTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		types       []string
+		contentType string
+		want        bool
+	}{
+		{"default compresses text", nil, "text/css; charset=utf-8", true},
+		{"default skips images", nil, "image/png", false},
+		{"allow-listed type", []string{"application/json"}, "application/json; charset=utf-8", true},
+		{"allow-listed prefix", []string{"text/*"}, "text/html", true},
+		{"not allow-listed", []string{"application/json"}, "text/html", false},
+		{"case-insensitive", []string{"Application/JSON"}, "application/json", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewGZipHandler(GZipConfig{ContentTypes: tt.types})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, strings.Repeat("payload ", 100))
+			}))
+			w := serve(h, http.MethodGet, "/", http.Header{"Accept-Encoding": {"gzip"}})
+			if got := w.Header().Get("Content-Encoding") == "gzip"; got != tt.want {
+				t.Errorf("compressed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGZipHandlerRange(t *testing.T) {
+	content := strings.Repeat("body{}", maxPrecompressSize/5)
+	dir := withStaticFiles(t, map[string]string{"css/big.css": content})
+	h := handler(Config{Router: NewRouter(), StaticFilesDirPath: dir})
+
+	w := serve(h, http.MethodGet, "/css/big.css", http.Header{"Accept-Encoding": {"gzip"}, "Range": {"bytes=0-99"}})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", w.Code)
+	}
+	if ce := w.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("partial response compressed with %s", ce)
+	}
+	if w.Body.String() != content[:100] {
+		t.Errorf("body is not bytes 0-99 of the file: %q", w.Body.String())
+	}
+}
+
+func TestGZipHandlerMergesVary(t *testing.T) {
+	h := GZipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Cookie")
+		io.WriteString(w, strings.Repeat("personalized ", 100))
+	}))
+	w := serve(h, http.MethodGet, "/", http.Header{"Accept-Encoding": {"gzip"}})
+
+	vary := strings.Join(w.Header().Values("Vary"), ", ")
+	for _, want := range []string{"Cookie", "Accept-Encoding"} {
+		if !strings.Contains(vary, want) {
+			t.Errorf("Vary = %q, missing %s", vary, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package goweb
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// settings are the Config values read while requests are served, by the
+// middleware, the router and helpers such as Render and BindJSON. Each chain
+// built by handler puts its own settings in the request context, so servers
+// started with different Configs can run side by side in one process.
+type settings struct {
+	jsonOptions           JSONOptions
+	slowRenderThreshold   time.Duration
+	strictTemplateVars    bool
+	apiMode               bool
+	apiPrefixes           []string
+	assetsRoot            string
+	devMode               bool
+	panicBodySnapshot     bool
+	trustedProxyCount     int
+	bodyTooLargeResponder ErrorResponder
+	decodeErrorResponder  ErrorResponder
+	router                *Router
+}
+
+// defaultAssetsRoot is the URL path assets are put under unless configured.
+const defaultAssetsRoot = "/public/assets"
+
+func newSettings(cfg Config) *settings {
+	s := &settings{
+		jsonOptions:           cfg.JSONOptions,
+		slowRenderThreshold:   cfg.SlowRenderThreshold,
+		strictTemplateVars:    cfg.StrictTemplateVars,
+		apiMode:               cfg.APIMode,
+		apiPrefixes:           cfg.APIPrefixes,
+		assetsRoot:            defaultAssetsRoot,
+		devMode:               cfg.DevMode,
+		panicBodySnapshot:     cfg.PanicBodySnapshot,
+		trustedProxyCount:     cfg.TrustedProxyCount,
+		bodyTooLargeResponder: defaultBodyTooLargeResponder,
+		decodeErrorResponder:  defaultDecodeErrorResponder,
+		router:                cfg.Router,
+	}
+	if cfg.AssetsRoot != "" {
+		s.assetsRoot = cleanAssetsRoot(cfg.AssetsRoot)
+	}
+	if cfg.BodyTooLargeResponder != nil {
+		s.bodyTooLargeResponder = cfg.BodyTooLargeResponder
+	}
+	if cfg.DecodeErrorResponder != nil {
+		s.decodeErrorResponder = cfg.DecodeErrorResponder
+	}
+	return s
+}
+
+// defaultSettings are used for requests that did not come through a chain
+// built by handler, and by the helpers that take no request, such as JSON,
+// StreamJSON and RenderTo. Building a chain makes its settings the defaults,
+// so those helpers follow the most recently started server.
+var defaultSettings atomic.Pointer[settings]
+
+func init() {
+	defaultSettings.Store(newSettings(Config{}))
+}
+
+// settingsFor returns the settings of the server that is serving r.
+func settingsFor(r *http.Request) *settings {
+	if r != nil {
+		if s, ok := r.Context().Value(settingsKey).(*settings); ok {
+			return s
+		}
+	}
+	return defaultSettings.Load()
+}
+
+// settingsHandler gives every request s.
+func settingsHandler(s *settings) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), settingsKey, s)))
+		}
+		return http.HandlerFunc(f)
+	}
+}
+
+// SetAssetsRoot sets the URL path the assetPath helper puts assets under,
+// e.g. "/static" or "/assets/v3", where no server's Config applies, such as
+// in RenderTo. The default is "/public/assets". Starting a server replaces
+// it with the server's Config.AssetsRoot.
+func SetAssetsRoot(root string) {
+	s := *defaultSettings.Load()
+	s.assetsRoot = cleanAssetsRoot(root)
+	defaultSettings.Store(&s)
+}
+
+func cleanAssetsRoot(root string) string {
+	return "/" + strings.Trim(root, "/")
+}
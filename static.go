@@ -0,0 +1,219 @@
+package goweb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPrecompressSize is the largest static file kept gzipped in memory.
+// Bigger files are served uncompressed straight from disk.
+const maxPrecompressSize = 1 << 20
+
+// precompressExts lists the text asset extensions worth gzipping.
+var precompressExts = map[string]bool{
+	".css":  true,
+	".js":   true,
+	".mjs":  true,
+	".map":  true,
+	".json": true,
+	".html": true,
+	".svg":  true,
+	".txt":  true,
+	".xml":  true,
+}
+
+// negotiableImageExts lists image extensions that may be swapped for a
+// modern format, and modernImageFormats the formats tried, best first.
+var (
+	negotiableImageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+	modernImageFormats  = []struct{ mediaType, ext string }{
+		{"image/avif", ".avif"},
+		{"image/webp", ".webp"},
+	}
+)
+
+// staticHandler serves the static files under dir. omitVary is
+// Config.GzipOmitVary, which applies to precompressed files as it does to
+// dynamic responses.
+func staticHandler(dir string, omitVary bool) http.Handler {
+	fs := http.Dir(dir)
+	return imageNegotiationHandler(fs, etagHandler(fs, newGzipStaticHandler(fs, omitVary, http.FileServer(fs))))
+}
+
+// staticETag identifies a version of a static file by its modification time
+// and size.
+func staticETag(fi os.FileInfo, suffix string) string {
+	return fmt.Sprintf(`"%x-%x%s"`, fi.ModTime().UnixNano(), fi.Size(), suffix)
+}
+
+// etagHandler sets an ETag for static files before serving them. The file
+// server and http.ServeContent check it against If-None-Match, alongside
+// their If-Modified-Since handling, and answer matching conditional requests
+// with a 304, so wrapped handlers never buffer or rewrite those responses.
+func etagHandler(fs http.FileSystem, next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if f, err := fs.Open(path.Clean("/" + r.URL.Path)); err == nil {
+			if fi, err := f.Stat(); err == nil && !fi.IsDir() {
+				w.Header().Set("ETag", staticETag(fi, ""))
+			}
+			f.Close()
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// imageNegotiationHandler serves photo.avif or photo.webp in place of a
+// requested photo.jpg when the client accepts the format and the sibling
+// file exists, falling back to the original otherwise.
+func imageNegotiationHandler(fs http.FileSystem, next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ext := strings.ToLower(path.Ext(r.URL.Path))
+		if !negotiableImageExts[ext] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		addVary(w.Header(), "Accept")
+		accept := r.Header.Get("Accept")
+		base := strings.TrimSuffix(r.URL.Path, path.Ext(r.URL.Path))
+		for _, format := range modernImageFormats {
+			if !acceptsMediaType(accept, format.mediaType) {
+				continue
+			}
+			candidate := base + format.ext
+			if !fileExists(fs, candidate) {
+				continue
+			}
+
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = candidate
+			r2.URL.RawPath = ""
+			next.ServeHTTP(w, r2)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func fileExists(fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	return err == nil && !fi.IsDir()
+}
+
+type gzipEntry struct {
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// gzipStaticHandler serves gzipped copies of text assets from an in-memory
+// cache keyed by file name, recompressing only when a file's modification
+// time or size changes. Everything else is passed to next.
+type gzipStaticHandler struct {
+	fs       http.FileSystem
+	omitVary bool
+	next     http.Handler
+
+	mu    sync.RWMutex
+	cache map[string]gzipEntry
+}
+
+func newGzipStaticHandler(fs http.FileSystem, omitVary bool, next http.Handler) *gzipStaticHandler {
+	return &gzipStaticHandler{fs: fs, omitVary: omitVary, next: next, cache: make(map[string]gzipEntry)}
+}
+
+func (h *gzipStaticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	name = path.Clean(name)
+	ext := path.Ext(name)
+
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+		!strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") ||
+		r.Header.Get("Range") != "" ||
+		!precompressExts[ext] ||
+		path.Base(name) == "index.html" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	f, err := h.fs.Open(name)
+	if err != nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() || fi.Size() > maxPrecompressSize {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	data, err := h.compressed(name, f, fi.ModTime(), fi.Size())
+	if err != nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	if !h.omitVary {
+		addVary(w.Header(), "Accept-Encoding")
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Set("ETag", staticETag(fi, "-gzip"))
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	http.ServeContent(w, r, name, fi.ModTime(), bytes.NewReader(data))
+}
+
+// compressed returns the gzipped contents of f, using the cached copy when
+// the file has not changed since it was compressed.
+func (h *gzipStaticHandler) compressed(name string, f io.Reader, modTime time.Time, size int64) ([]byte, error) {
+	h.mu.RLock()
+	entry, ok := h.cache[name]
+	h.mu.RUnlock()
+	if ok && entry.modTime.Equal(modTime) && entry.size == size {
+		return entry.data, nil
+	}
+
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(gz, f); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.cache[name] = gzipEntry{modTime: modTime, size: size, data: buf.Bytes()}
+	h.mu.Unlock()
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,135 @@
+package goweb
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withStaticFiles writes files into a temporary directory and returns it.
+func withStaticFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestStaticGzipVary(t *testing.T) {
+	dir := withStaticFiles(t, map[string]string{"app.css": strings.Repeat("body{}", 100)})
+
+	for _, omitVary := range []bool{false, true} {
+		w := serve(staticHandler(dir, omitVary), http.MethodGet, "/app.css", http.Header{"Accept-Encoding": {"gzip"}})
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("omitVary %v: Content-Encoding = %q", omitVary, got)
+		}
+		vary := w.Header().Get("Vary")
+		if omitVary && vary != "" {
+			t.Errorf("omitVary: Vary = %q, want none", vary)
+		}
+		if !omitVary && vary != "Accept-Encoding" {
+			t.Errorf("Vary = %q, want Accept-Encoding", vary)
+		}
+	}
+}
+
+func TestStaticConditionalRequests(t *testing.T) {
+	dir := withStaticFiles(t, map[string]string{"app.css": strings.Repeat("body{}", 100)})
+	h := staticHandler(dir, false)
+
+	variants := []struct {
+		name   string
+		header http.Header
+		suffix string
+	}{
+		{"plain", http.Header{}, ""},
+		{"gzip", http.Header{"Accept-Encoding": {"gzip"}}, "-gzip\""},
+	}
+	for _, v := range variants {
+		t.Run(v.name, func(t *testing.T) {
+			w := serve(h, http.MethodGet, "/app.css", v.header)
+			etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+			if w.Code != http.StatusOK || etag == "" || lastModified == "" {
+				t.Fatalf("status %d, ETag %q, Last-Modified %q", w.Code, etag, lastModified)
+			}
+			if v.suffix != "" && !strings.HasSuffix(etag, v.suffix) {
+				t.Errorf("ETag %q does not name the gzip variant", etag)
+			}
+
+			conditions := []http.Header{
+				{"If-None-Match": {etag}},
+				{"If-Modified-Since": {lastModified}},
+			}
+			for _, cond := range conditions {
+				header := cond.Clone()
+				for k, vals := range v.header {
+					header[k] = vals
+				}
+				w := serve(h, http.MethodGet, "/app.css", header)
+				if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+					t.Errorf("%v: status %d with %d body bytes, want 304 and none", cond, w.Code, w.Body.Len())
+				}
+			}
+
+			// a stale validator gets the full response
+			w = serve(h, http.MethodGet, "/app.css", http.Header{"If-None-Match": {`"stale"`}, "Accept-Encoding": v.header["Accept-Encoding"]})
+			if w.Code != http.StatusOK {
+				t.Errorf("stale If-None-Match: status %d, want 200", w.Code)
+			}
+		})
+	}
+
+	// the plain ETag must not validate the gzip variant
+	plain := serve(h, http.MethodGet, "/app.css", nil).Header().Get("ETag")
+	w := serve(h, http.MethodGet, "/app.css", http.Header{"If-None-Match": {plain}, "Accept-Encoding": {"gzip"}})
+	if w.Code != http.StatusOK {
+		t.Errorf("plain ETag validated the gzip variant: status %d", w.Code)
+	}
+}
+
+func TestStaticConditionalRequestsThroughChain(t *testing.T) {
+	dir := withStaticFiles(t, map[string]string{
+		"css/app.css": strings.Repeat("body{}", 100),
+		// too big to precompress, so the global gzip middleware compresses it
+		"css/big.css": strings.Repeat("body{}", maxPrecompressSize/5),
+	})
+	h := handler(Config{Router: NewRouter(), StaticFilesDirPath: dir})
+	gzip := http.Header{"Accept-Encoding": {"gzip"}}
+
+	for _, file := range []string{"/css/app.css", "/css/big.css"} {
+		t.Run(file, func(t *testing.T) {
+			plain := serve(h, http.MethodGet, file, nil).Header().Get("ETag")
+			w := serve(h, http.MethodGet, file, gzip)
+			zipped := w.Header().Get("ETag")
+			if w.Header().Get("Content-Encoding") != "gzip" || zipped == "" || zipped == plain {
+				t.Fatalf("Content-Encoding %q, gzip ETag %q, plain ETag %q", w.Header().Get("Content-Encoding"), zipped, plain)
+			}
+
+			tests := []struct {
+				name   string
+				header http.Header
+				want   int
+				etag   string
+			}{
+				{"plain revalidated", http.Header{"If-None-Match": {plain}}, http.StatusNotModified, plain},
+				{"gzip revalidated", http.Header{"If-None-Match": {zipped}, "Accept-Encoding": {"gzip"}}, http.StatusNotModified, zipped},
+				{"gzip tag for plain request", http.Header{"If-None-Match": {zipped}}, http.StatusOK, plain},
+			}
+			for _, tt := range tests {
+				w := serve(h, http.MethodGet, file, tt.header)
+				if w.Code != tt.want || w.Header().Get("ETag") != tt.etag {
+					t.Errorf("%s: status %d ETag %q, want %d %q", tt.name, w.Code, w.Header().Get("ETag"), tt.want, tt.etag)
+				}
+			}
+		})
+	}
+}
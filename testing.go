@@ -0,0 +1,59 @@
+package goweb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+// CapturedResponse is a response recorded by CaptureResponse.
+type CapturedResponse struct {
+	Status int
+	Header http.Header
+
+	// Body is the response body, decompressed if it was gzipped.
+	Body []byte
+
+	// Compressed reports whether the body was sent gzipped.
+	Compressed bool
+}
+
+// BodyString returns the decompressed body as a string.
+func (c *CapturedResponse) BodyString() string {
+	return string(c.Body)
+}
+
+// CaptureResponse serves req with handler and returns the final response,
+// gunzipping the body when the chain compressed it so tests can assert on
+// plain text. It is meant for tests that exercise the full middleware chain.
+// A body marked as gzipped that does not decompress is an error, since
+// clients could not read it either; the response is still returned with the
+// raw body for inspection.
+func CaptureResponse(handler http.Handler, req *http.Request) (*CapturedResponse, error) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	res := &CapturedResponse{
+		Status: rec.Code,
+		Header: rec.Header(),
+		Body:   rec.Body.Bytes(),
+	}
+
+	if rec.Header().Get("Content-Encoding") == "gzip" && len(res.Body) > 0 {
+		zr, err := gzip.NewReader(bytes.NewReader(res.Body))
+		if err != nil {
+			return res, fmt.Errorf("goweb: invalid gzip response body: %w", err)
+		}
+		defer zr.Close()
+		body, err := io.ReadAll(zr)
+		if err != nil {
+			return res, fmt.Errorf("goweb: invalid gzip response body: %w", err)
+		}
+		res.Body = body
+		res.Compressed = true
+	}
+	return res, nil
+}
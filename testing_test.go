@@ -0,0 +1,38 @@
+package goweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCaptureResponseGunzips(t *testing.T) {
+	router := NewRouter()
+	router.GET("/", reply(strings.Repeat("hello ", 100)))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	res, err := CaptureResponse(handler(Config{Router: router}), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Compressed || res.BodyString() != strings.Repeat("hello ", 100) {
+		t.Errorf("compressed %v, body %q", res.Compressed, res.BodyString())
+	}
+}
+
+func TestCaptureResponseInvalidGzip(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte("not gzip"))
+	})
+
+	res, err := CaptureResponse(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err == nil {
+		t.Fatal("expected an error for an invalid gzip body")
+	}
+	if res.Compressed || res.BodyString() != "not gzip" {
+		t.Errorf("compressed %v, body %q", res.Compressed, res.BodyString())
+	}
+}
@@ -0,0 +1,91 @@
+package goweb
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// certCheckInterval is how often certReloader looks at the certificate files
+// for changes. Handshakes in between use the loaded certificate without
+// touching the disk or taking a lock.
+var certCheckInterval = 5 * time.Second
+
+// certReloader serves the certificate in certFile and keyFile, loading it
+// again when either file changes on disk, so renewed certificates are used
+// within certCheckInterval without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	cert      atomic.Pointer[tls.Certificate]
+	nextCheck atomic.Int64 // unix nanoseconds
+
+	mu      sync.Mutex // held while checking the files
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// newCertReloader loads the certificate, failing when it cannot be read.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := c.certificate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// certificate returns the current certificate, checking at most once per
+// certCheckInterval whether the files' modification times changed and
+// reloading it if so. While one handshake checks, the others keep using the
+// current certificate. A failed reload, e.g. while the files are being
+// replaced, keeps the previous certificate and is tried again at the next
+// check.
+func (c *certReloader) certificate() (*tls.Certificate, error) {
+	cert := c.cert.Load()
+	if cert != nil && time.Now().UnixNano() < c.nextCheck.Load() {
+		return cert, nil
+	}
+	if cert != nil {
+		if !c.mu.TryLock() {
+			return cert, nil
+		}
+	} else {
+		c.mu.Lock()
+	}
+	defer c.mu.Unlock()
+
+	// another handshake may have checked while we waited for the lock
+	if cert = c.cert.Load(); cert != nil && time.Now().UnixNano() < c.nextCheck.Load() {
+		return cert, nil
+	}
+	defer c.nextCheck.Store(time.Now().Add(certCheckInterval).UnixNano())
+
+	certInfo, certErr := os.Stat(c.certFile)
+	keyInfo, keyErr := os.Stat(c.keyFile)
+	if cert != nil && certErr == nil && keyErr == nil &&
+		certInfo.ModTime().Equal(c.certMod) && keyInfo.ModTime().Equal(c.keyMod) {
+		return cert, nil
+	}
+
+	loaded, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if cert != nil {
+			log.Printf("Error reloading TLS certificate, keeping the previous one: %s", err)
+			return cert, nil
+		}
+		return nil, err
+	}
+	c.cert.Store(&loaded)
+	if certErr == nil && keyErr == nil {
+		c.certMod, c.keyMod = certInfo.ModTime(), keyInfo.ModTime()
+	}
+	return &loaded, nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.certificate()
+}